@@ -17,21 +17,32 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/netlinksafe"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 
 	"github.com/intel/bond-cni/bond/util"
 )
@@ -44,14 +55,80 @@ type bondingConfig struct {
 	Miimon      string                   `json:"miimon"`
 	Links       []map[string]interface{} `json:"links"`
 	MTU         int                      `json:"mtu"`
+	DataDir     string                   `json:"dataDir"`
+
+	LoadBondingModule bool `json:"loadBondingModule,omitempty"`
 
 	AllSlavesActive *int    `json:"allSlavesActive,omitempty"`
 	TlbDynamicLb    *int    `json:"tlbDynamicLb,omitempty"`
 	XmitHashPolicy  *string `json:"xmitHashPolicy,omitempty"`
+
+	ArpInterval   *int     `json:"arpInterval,omitempty"`
+	ArpIpTargets  []string `json:"arpIpTargets,omitempty"`
+	ArpValidate   *string  `json:"arpValidate,omitempty"`
+	ArpAllTargets *string  `json:"arpAllTargets,omitempty"`
+	ArpMissedMax  *int     `json:"arpMissedMax,omitempty"`
+
+	ArpTargetsFromIPAM bool     `json:"arpTargetsFromIPAM,omitempty"`
+	NsIp6Targets       []string `json:"nsIp6Targets,omitempty"`
+
+	LacpRate       *string `json:"lacpRate,omitempty"`
+	LacpActive     *string `json:"lacpActive,omitempty"`
+	AdSelect       *string `json:"adSelect,omitempty"`
+	AdActorSysPrio *int    `json:"adActorSysPrio,omitempty"`
+	AdUserPortKey  *int    `json:"adUserPortKey,omitempty"`
+	AdActorSystem  *string `json:"adActorSystem,omitempty"`
+
+	Primary         *int    `json:"primary,omitempty"`
+	PrimaryReselect *string `json:"primaryReselect,omitempty"`
+	ActiveSlave     *int    `json:"activeSlave,omitempty"`
+
+	UpDelay        *int `json:"updelay,omitempty"`
+	DownDelay      *int `json:"downdelay,omitempty"`
+	PeerNotifDelay *int `json:"peerNotifDelay,omitempty"`
+
+	MinLinks *int `json:"minLinks,omitempty"`
+
+	NumGratArp *int `json:"numGratArp,omitempty"`
+	NumUnsolNa *int `json:"numUnsolNa,omitempty"`
+	ResendIgmp *int `json:"resendIgmp,omitempty"`
+
+	PacketsPerSlave *int `json:"packetsPerSlave,omitempty"`
+	LpInterval      *int `json:"lpInterval,omitempty"`
+
+	RuntimeConfig struct {
+		DeviceIDs []string `json:"deviceIDs,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
 }
 
 var bondCni = "bond"
 
+// the kernel limits the number of ARP monitor targets, BOND_MAX_ARP_TARGETS, and of NS monitor targets, BOND_MAX_NS_TARGETS
+const (
+	maxArpIpTargets = 16
+	maxNsIp6Targets = 16
+)
+
+// lacp_active values, netlink.Bond has no field for the option
+var lacpActiveValues = map[string]uint8{
+	"off": 0,
+	"on":  1,
+}
+
+// the user port key is the upper 10 bits of the LACP port key
+const maxAdUserPortKey = 1023
+
+// arp_validate values, netlink only names the ones preceding the filter modes
+var arpValidateValues = map[string]netlink.BondArpValidate{
+	"none":          netlink.BOND_ARP_VALIDATE_NONE,
+	"active":        netlink.BOND_ARP_VALIDATE_ACTIVE,
+	"backup":        netlink.BOND_ARP_VALIDATE_BACKUP,
+	"all":           netlink.BOND_ARP_VALIDATE_ALL,
+	"filter":        netlink.BondArpValidate(4),
+	"filter_active": netlink.BondArpValidate(5),
+	"filter_backup": netlink.BondArpValidate(6),
+}
+
 func init() {
 	// this ensures that main runs only on main thread (thread group leader).
 	// since namespace ops (unshare, setns) are done for a single thread, we
@@ -59,305 +136,1590 @@ func init() {
 	runtime.LockOSThread()
 }
 
-// load the configuration file into a bondingConfig structure. return the bondConf & error
-func loadConfigFile(bytes []byte) (*bondingConfig, string, error) {
-	bondConf := &bondingConfig{}
-	if err := json.Unmarshal(bytes, bondConf); err != nil {
-		return nil, "", fmt.Errorf("failed to load configuration file, error = %+v", err)
+// addTransaction records how to undo each completed step of an ADD, so a failure halfway
+// does not leave a partially built bond, enslaved links or a leaked IPAM lease behind
+type addTransaction struct {
+	undoSteps []func() error
+}
+
+// record the undo operation of a step which has just been completed
+func (tx *addTransaction) record(undo func() error) {
+	tx.undoSteps = append(tx.undoSteps, undo)
+}
+
+// run the recorded undo operations in reverse order. return the original error, extended with any rollback failures
+func (tx *addTransaction) rollback(addErr error) error {
+	var undoErrs []error
+	for i := len(tx.undoSteps) - 1; i >= 0; i-- {
+		if err := tx.undoSteps[i](); err != nil {
+			undoErrs = append(undoErrs, err)
+		}
 	}
+	tx.undoSteps = nil
 
-	if bondConf.IPAM.Type == bondCni {
-		return nil, "", fmt.Errorf("bond is not a suitable IPAM type")
+	if len(undoErrs) > 0 {
+		return fmt.Errorf("%w, failed to roll back: %w", addErr, errors.Join(undoErrs...))
 	}
+	return addErr
+}
 
-	bondMode := netlink.StringToBondMode(bondConf.Mode)
-	if bondMode == netlink.BOND_MODE_UNKNOWN {
-		return nil, "", fmt.Errorf("bonding mode (%+v) is not supported", bondConf.Mode)
+// load the configuration file into a bondingConfig structure. only what is needed to find the links, the
+// network namespace and the IPAM plugin is checked, so DEL, CHECK and GC can still tear down attachments
+// whose configuration a newer plugin would reject on ADD. a configuration or prevResult which cannot be decoded
+// fails with a decoding error, unlike the invalid configuration errors of the checks. return the bondConf & error
+func loadConfigFile(bytes []byte) (*bondingConfig, string, error) {
+	errs := &configErrors{}
+	bondConf, err := decodeConfigFile(bytes, errs)
+	if err != nil {
+		return nil, "", err
 	}
+	if err = errs.asError(); err != nil {
+		return nil, "", err
+	}
+	return bondConf, bondConf.CNIVersion, nil
+}
 
-	if bondConf.FailOverMac < 0 || bondConf.FailOverMac > 2 {
-		return nil, "", fmt.Errorf("FailOverMac mode should be 0, 1 or 2 actual: %+v", bondConf.FailOverMac)
+// decode the configuration file and its prevResult. the link entries which cannot select a link are added to
+// errs, only a configuration which cannot be decoded fails. return the bondConf & error
+func decodeConfigFile(bytes []byte, errs *configErrors) (*bondingConfig, error) {
+	bondConf, err := decodeBondingConfig(bytes, errs)
+	if err != nil {
+		return nil, types.NewError(types.ErrDecodingFailure, "failed to load configuration file", err.Error())
 	}
 
-	if bondConf.AllSlavesActive != nil && *bondConf.AllSlavesActive != 0 && *bondConf.AllSlavesActive != 1 {
-		return nil, "", fmt.Errorf("allSlavesActive should be 0 or 1, actual: %+v", *bondConf.AllSlavesActive)
+	if bondConf.DataDir == "" {
+		bondConf.DataDir = util.DefaultDataDir
 	}
 
-	if bondConf.TlbDynamicLb != nil {
-		if bondMode != netlink.BOND_MODE_BALANCE_TLB && bondMode != netlink.BOND_MODE_BALANCE_ALB {
-			return nil, "", fmt.Errorf("tlbDynamicLb is only supported in balance-tlb or balance-alb mode, actual: %+v", bondConf.Mode)
+	// devices allocated by the device plugin are passed by Multus when the links are not named
+	if len(bondConf.Links) == 0 {
+		for _, deviceID := range bondConf.RuntimeConfig.DeviceIDs {
+			bondConf.Links = append(bondConf.Links, map[string]interface{}{"deviceID": deviceID})
 		}
+	}
 
-		if *bondConf.TlbDynamicLb != 0 && *bondConf.TlbDynamicLb != 1 {
-			return nil, "", fmt.Errorf("tlbDynamicLb should be 0 or 1, actual: %+v", *bondConf.TlbDynamicLb)
-		}
+	// the links must be found to tear the bond down as well
+	for i, link := range bondConf.Links {
+		errs.add(fmt.Sprintf("links[%d]", i), validateLinkSelector(link))
 	}
 
-	if bondConf.XmitHashPolicy != nil && netlink.StringToBondXmitHashPolicy(*bondConf.XmitHashPolicy) == netlink.BOND_XMIT_HASH_POLICY_UNKNOWN {
-		return nil, "", fmt.Errorf("xmitHashPolicy is not supported, actual: %+v", *bondConf.XmitHashPolicy)
+	if err := version.ParsePrevResult(&bondConf.NetConf); err != nil {
+		return nil, types.NewError(types.ErrDecodingFailure, "failed to parse prevResult", err.Error())
 	}
 
+	return bondConf, nil
+}
+
+// load the configuration file of an ADD of the bond ifName and check the bond can be created with it. the
+// problems of the link entries are reported along with those of the options. return the bondConf & error
+func loadAddConfig(bytes []byte, ifName string) (*bondingConfig, string, error) {
+	errs := &configErrors{}
+	bondConf, err := decodeConfigFile(bytes, errs)
+	if err != nil {
+		return nil, "", err
+	}
+	errs.add("links", resolveLinksFromPrevResult(bondConf, ifName))
+	validateConfig(bondConf, errs)
+	if err = errs.asError(); err != nil {
+		return nil, "", err
+	}
 	return bondConf, bondConf.CNIVersion, nil
 }
 
-// retrieve the link names from the bondConf & check they exist. return an array of linkObjectsToBond & error
-func getLinkObjectsFromConfig(bondConf *bondingConfig, netNsHandle *netlinksafe.Handle, releaseLinks bool) ([]netlink.Link, error) {
-	linkNames := []string{}
-	for _, linkName := range bondConf.Links {
-		s, ok := linkName["name"].(string)
-		if !ok {
-			return nil, fmt.Errorf("failed to find link name")
-		}
-		linkNames = append(linkNames, s)
+// check the links and the options against the mode, their ranges and each other. this only runs on ADD, the
+// other commands must keep working with a configuration accepted by an earlier ADD. every problem found is
+// added to errs, so a broken configuration can be fixed in one go
+func validateConfig(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.IPAM.Type == bondCni {
+		errs.add("ipam", fmt.Errorf("bond is not a suitable IPAM type"))
 	}
 
-	// currently supporting two or more links to one bond.
-	if len(linkNames) < 2 {
-		return nil, fmt.Errorf("bonding requires at least two links, we have %+v", len(linkNames))
+	// currently supporting two or more links to one bond
+	if len(bondConf.Links) < 2 {
+		errs.add("links", fmt.Errorf("bonding requires at least two links, actual: %+v", len(bondConf.Links)))
 	}
 
-	linkObjectsToBond := []netlink.Link{}
-	for _, linkName := range linkNames {
-		linkObject, err := netNsHandle.LinkByName(linkName)
-		if err != nil {
-			// Do not fail if device in container assigned to the bond has been deleted.
-			// This device might have been deleted by another plugin.
-			_, ok := err.(netlink.LinkNotFoundError)
-			if !ok || !releaseLinks {
-				return nil, fmt.Errorf("failed to confirm that link (%+v) exists, error: %+v", linkName, err)
-			}
-		} else {
-			linkObjectsToBond = append(linkObjectsToBond, linkObject)
-		}
+	bondMode := netlink.StringToBondMode(bondConf.Mode)
+	if bondMode == netlink.BOND_MODE_UNKNOWN {
+		errs.add("mode", fmt.Errorf("bonding mode (%+v) is not supported", bondConf.Mode))
 	}
 
-	return linkObjectsToBond, nil
-}
+	if _, err := getMiimon(bondConf); err != nil {
+		errs.add("miimon", err)
+	}
 
-// configure the bonded link & add it using the netNsHandle context to add it to the required namespace. return a bondLinkObj pointer & error
-func createBondedLink(bondName string, bondConf *bondingConfig, netNsHandle *netlinksafe.Handle) (*netlink.Bond, error) {
-	var err error
+	// the mode and range of each option, the checks below cover the options depending on each other
+	validateBondOptions(bondConf, bondMode, errs)
 
-	bondLinkObj := netlink.NewLinkBond(netlink.NewLinkAttrs())
-	bondLinkObj.Attrs().Name = bondName
+	if bondConf.XmitHashPolicy != nil && netlink.StringToBondXmitHashPolicy(*bondConf.XmitHashPolicy) == netlink.BOND_XMIT_HASH_POLICY_UNKNOWN {
+		errs.add("xmitHashPolicy", fmt.Errorf("xmitHashPolicy is not supported, actual: %+v", *bondConf.XmitHashPolicy))
+	}
 
-	bondModeObj := netlink.StringToBondMode(bondConf.Mode)
-	bondLinkObj.Mode = bondModeObj
+	validateArpMonitor(bondConf, errs)
+	validateMonitorDelays(bondConf, errs)
+	validateFailoverNotifications(bondConf, errs)
+	validateLacp(bondConf, errs)
 
-	bondLinkObj.Miimon, err = strconv.Atoi(bondConf.Miimon)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert bondMiimon value (%+v) to an int, error: %+v", bondConf.Miimon, err)
-	}
+	// the primary and the active slave reference link entries, which are only known once taken from prevResult
+	validatePrimary(bondConf, errs)
+	validateMinLinks(bondConf, errs)
+}
 
-	if bondConf.MTU != 0 {
-		bondLinkObj.MTU = bondConf.MTU
+// check the ARP monitor options are consistent with each other and miimon. add the problems to errs
+func validateArpMonitor(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.ArpInterval == nil || *bondConf.ArpInterval == 0 {
+		if len(bondConf.ArpIpTargets) > 0 || bondConf.ArpValidate != nil || bondConf.ArpAllTargets != nil || bondConf.ArpMissedMax != nil ||
+			bondConf.ArpTargetsFromIPAM || len(bondConf.NsIp6Targets) > 0 {
+			errs.add("arpInterval", fmt.Errorf("arpIpTargets, arpValidate, arpAllTargets, arpMissedMax, arpTargetsFromIPAM and nsIp6Targets require arpInterval to be set"))
+		}
+		return
 	}
 
-	bondLinkObj.FailOverMac = netlink.BondFailOverMac(bondConf.FailOverMac)
-
-	if bondConf.AllSlavesActive != nil {
-		bondLinkObj.AllSlavesActive = *bondConf.AllSlavesActive
+	// an invalid miimon is reported on its own
+	if miimon, err := getMiimon(bondConf); err == nil && miimon != 0 {
+		errs.add("miimon", fmt.Errorf("arpInterval and miimon are mutually exclusive, miimon should be unset or 0, actual: %+v", bondConf.Miimon))
 	}
 
-	if bondConf.TlbDynamicLb != nil {
-		bondLinkObj.TlbDynamicLb = *bondConf.TlbDynamicLb
+	if bondConf.ArpTargetsFromIPAM && bondConf.IPAM.Type == "" {
+		errs.add("arpTargetsFromIPAM", fmt.Errorf("arpTargetsFromIPAM requires an IPAM plugin to be configured"))
 	}
 
-	if bondConf.XmitHashPolicy != nil {
-		bondLinkObj.XmitHashPolicy = netlink.StringToBondXmitHashPolicy(*bondConf.XmitHashPolicy)
+	// the IPAM gateways complete the targets once the addresses are allocated, an IPv6 only bond is monitored by NS targets
+	if (len(bondConf.ArpIpTargets) == 0 && !bondConf.ArpTargetsFromIPAM && len(bondConf.NsIp6Targets) == 0) || len(bondConf.ArpIpTargets) > maxArpIpTargets {
+		errs.add("arpIpTargets", fmt.Errorf("arpIpTargets should hold between 1 and %+v addresses, actual: %+v", maxArpIpTargets, len(bondConf.ArpIpTargets)))
+	}
+	for _, target := range bondConf.ArpIpTargets {
+		if ip := net.ParseIP(target); ip == nil || ip.To4() == nil {
+			errs.add("arpIpTargets", fmt.Errorf("arpIpTargets should only hold IPv4 addresses, actual: %+v", target))
+		}
 	}
 
-	err = netNsHandle.LinkAdd(bondLinkObj)
-	if err != nil {
-		return nil, fmt.Errorf("failed to add link (%+v) to the netNsHandle, error: %+v", bondLinkObj.Attrs().Name, err)
+	errs.add("nsIp6Targets", validateNsIp6Targets(bondConf.NsIp6Targets))
+
+	if bondConf.ArpValidate != nil {
+		if _, ok := arpValidateValues[*bondConf.ArpValidate]; !ok {
+			errs.add("arpValidate", fmt.Errorf("arpValidate is not supported, actual: %+v", *bondConf.ArpValidate))
+		}
 	}
 
-	return bondLinkObj, nil
+	if bondConf.ArpAllTargets != nil {
+		if _, ok := netlink.StringToBondArpAllTargetsMap[*bondConf.ArpAllTargets]; !ok {
+			errs.add("arpAllTargets", fmt.Errorf("arpAllTargets should be any or all, actual: %+v", *bondConf.ArpAllTargets))
+		}
+	}
 }
 
-// loop over the linkObjectsToBond, set each DOWN, update the interface MASTER & set it UP again.
-// again we use the netNsHandle to interfact with these links in the namespace provided. return error
-func attachLinksToBond(bondLinkObj *netlink.Bond, linkObjectsToBond []netlink.Link, netNsHandle *netlinksafe.Handle) error {
-	err := util.HandleMacDuplicates(linkObjectsToBond, netNsHandle)
-	if err != nil {
-		return fmt.Errorf("failed to handle duplicated macs on link slaves, error: %+v", err)
+// check the NS monitor targets are unicast IPv6 addresses and the kernel can monitor them. return error
+func validateNsIp6Targets(nsIp6Targets []string) error {
+	if len(nsIp6Targets) == 0 {
+		return nil
 	}
 
-	bondLinkIndex := bondLinkObj.Index
-	for _, linkObject := range linkObjectsToBond {
-		err = netNsHandle.LinkSetDown(linkObject)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v DOWN, error: %+v", linkObject.Attrs().Name, err)
-		}
-		err = netNsHandle.LinkSetMasterByIndex(linkObject, bondLinkIndex)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v MASTER, master index used: %+v, error: %+v", linkObject.Attrs().Name, bondLinkIndex, err)
-		}
-		err = netNsHandle.LinkSetUp(linkObject)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v UP, error: %+v", linkObject.Attrs().Name, err)
+	if len(nsIp6Targets) > maxNsIp6Targets {
+		return fmt.Errorf("nsIp6Targets should hold at most %+v addresses, actual: %+v", maxNsIp6Targets, len(nsIp6Targets))
+	}
+	for _, target := range nsIp6Targets {
+		ip := net.ParseIP(target)
+		if ip == nil || ip.To4() != nil || !(ip.IsGlobalUnicast() || ip.IsLinkLocalUnicast()) {
+			return fmt.Errorf("nsIp6Targets should only hold global or link-local IPv6 addresses, actual: %+v", target)
 		}
 	}
 	return nil
 }
 
-// loop over the linkObjectsToDeattach, set each DOWN, update the interface MASTER to nomaster & set it UP again.
-// again we use the netNsHandle to interfact with these links in the namespace provided. return error
-func deattachLinksFromBond(linkObjectsToDeattach []netlink.Link, netNsHandle *netlinksafe.Handle) error {
-	var err error
+// check the delays are multiples of miimon, which the kernel would otherwise round them down to. the kernel
+// refuses any delay while the MII monitor is disabled. add the problems to errs
+func validateMonitorDelays(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.UpDelay == nil && bondConf.DownDelay == nil && bondConf.PeerNotifDelay == nil {
+		return
+	}
 
-	for _, linkObject := range linkObjectsToDeattach {
-		err = netNsHandle.LinkSetDown(linkObject)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v DOWN, error: %+v", linkObject.Attrs().Name, err)
+	// an invalid miimon is reported on its own
+	miimon, err := getMiimon(bondConf)
+	if err != nil {
+		return
+	}
+
+	for _, delay := range []struct {
+		name  string
+		value *int
+	}{
+		{"updelay", bondConf.UpDelay},
+		{"downdelay", bondConf.DownDelay},
+		{"peerNotifDelay", bondConf.PeerNotifDelay},
+	} {
+		if delay.value == nil {
+			continue
 		}
-		err = netNsHandle.LinkSetNoMaster(linkObject)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v NOMASTER, error: %+v", linkObject.Attrs().Name, err)
+		// the delays are counted in MII monitor intervals
+		if miimon == 0 {
+			errs.add(delay.name, fmt.Errorf("%+v requires miimon to be set", delay.name))
 		}
-		err = netNsHandle.LinkSetUp(linkObject)
-		if err != nil {
-			return fmt.Errorf("failed to set link: %+v UP, error: %+v", linkObject.Attrs().Name, err)
+		if miimon > 0 && *delay.value%miimon != 0 {
+			errs.add(delay.name, fmt.Errorf("%+v should be a multiple of miimon (%+v), actual: %+v", delay.name, miimon, *delay.value))
 		}
 	}
-	return nil
 }
 
-func setLinksInNetNs(bondConf *bondingConfig, nspath string, releaseLinks bool) error {
-	var podNs, hostNS ns.NetNS
-	var err error
+// check numGratArp and numUnsolNa do not conflict. add the problems to errs
+func validateFailoverNotifications(bondConf *bondingConfig, errs *configErrors) {
+	// both options set the same num_peer_notif of the bond
+	if bondConf.NumGratArp != nil && bondConf.NumUnsolNa != nil && *bondConf.NumGratArp != *bondConf.NumUnsolNa {
+		errs.add("numUnsolNa", fmt.Errorf("numGratArp and numUnsolNa should be equal, actual: %+v and %+v", *bondConf.NumGratArp, *bondConf.NumUnsolNa))
+	}
+}
 
-	linkNames := []string{}
-	for _, linkName := range bondConf.Links {
-		s, ok := linkName["name"].(string)
-		if !ok {
-			return fmt.Errorf("failed to find link name")
-		}
-		linkNames = append(linkNames, s)
+// check the LACP options hold values the kernel accepts. add the problems to errs
+func validateLacp(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.LacpRate != nil && netlink.StringToBondLacpRate(*bondConf.LacpRate) == netlink.BOND_LACP_RATE_UNKNOWN {
+		errs.add("lacpRate", fmt.Errorf("lacpRate should be slow or fast, actual: %+v", *bondConf.LacpRate))
 	}
 
-	if podNs, err = ns.GetNS(nspath); err != nil {
-		return fmt.Errorf("failed to open netns %q: %v", nspath, err)
+	if bondConf.LacpActive != nil {
+		if _, ok := lacpActiveValues[*bondConf.LacpActive]; !ok {
+			errs.add("lacpActive", fmt.Errorf("lacpActive should be on or off, actual: %+v", *bondConf.LacpActive))
+		}
 	}
-	defer func() {
-		_ = podNs.Close()
-	}()
 
-	if hostNS, err = ns.GetCurrentNS(); err != nil {
-		return fmt.Errorf("failed to get init netns: %v", err)
+	if bondConf.AdSelect != nil {
+		if _, ok := netlink.StringToBondAdSelectMap[*bondConf.AdSelect]; !ok {
+			errs.add("adSelect", fmt.Errorf("adSelect should be stable, bandwidth or count, actual: %+v", *bondConf.AdSelect))
+		}
 	}
 
-	if releaseLinks {
-		return moveLinksBetweenNs(linkNames, podNs, hostNS, "host")
+	if bondConf.AdActorSystem != nil {
+		mac, err := net.ParseMAC(*bondConf.AdActorSystem)
+		if err != nil || len(mac) != 6 {
+			errs.add("adActorSystem", fmt.Errorf("adActorSystem should be a MAC address, actual: %+v", *bondConf.AdActorSystem))
+		} else if mac[0]&1 == 1 || bytes.Equal(mac, make(net.HardwareAddr, 6)) {
+			errs.add("adActorSystem", fmt.Errorf("adActorSystem should be a non-zero unicast MAC address, actual: %+v", *bondConf.AdActorSystem))
+		}
 	}
-	return moveLinksBetweenNs(linkNames, hostNS, podNs, "container")
 }
 
-func moveLinksBetweenNs(links []string, from ns.NetNS, to ns.NetNS, toNsName string) error {
-	return from.Do(func(ns.NetNS) error {
-		if len(links) < 2 { // currently supporting two or more links to one bond
-			return fmt.Errorf("bonding requires at least two links, we have %+v", len(links))
-		}
-		for _, linkName := range links {
-			// get interface link in the network namespace
-			link, err := netlink.LinkByName(linkName)
-			if err != nil {
-				return fmt.Errorf("failed to lookup link interface %q: %v", linkName, err)
-			}
+// check the primary and the active slave reference link entries. add the problems to errs
+func validatePrimary(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.Primary != nil && (*bondConf.Primary < 0 || *bondConf.Primary >= len(bondConf.Links)) {
+		errs.add("primary", fmt.Errorf("primary should be the index of a link entry, between 0 and %+v, actual: %+v", len(bondConf.Links)-1, *bondConf.Primary))
+	}
 
-			// set link interface down
-			if err = netlink.LinkSetDown(link); err != nil {
-				return fmt.Errorf("failed to down link interface %q: %v", linkName, err)
-			}
+	if bondConf.ActiveSlave != nil && (*bondConf.ActiveSlave < 0 || *bondConf.ActiveSlave >= len(bondConf.Links)) {
+		errs.add("activeSlave", fmt.Errorf("activeSlave should be the index of a link entry, between 0 and %+v, actual: %+v", len(bondConf.Links)-1, *bondConf.ActiveSlave))
+	}
 
-			// move link interface to network netns
-			if err = netlink.LinkSetNsFd(link, int(to.Fd())); err != nil {
-				return fmt.Errorf("failed to move link interface to %s netns %q: %v", toNsName, linkName, err)
-			}
+	if bondConf.PrimaryReselect != nil {
+		if _, ok := netlink.StringToBondPrimaryReselectMap[*bondConf.PrimaryReselect]; !ok {
+			errs.add("primaryReselect", fmt.Errorf("primaryReselect should be always, better or failure, actual: %+v", *bondConf.PrimaryReselect))
 		}
-		return nil
-	})
+	}
 }
 
-func createBond(bondName string, bondConf *bondingConfig, nspath string, ns ns.NetNS) (*current.Interface, error) {
-	bond := &current.Interface{}
+// check the bond can ever have minLinks active slaves. add the problems to errs
+func validateMinLinks(bondConf *bondingConfig, errs *configErrors) {
+	if bondConf.MinLinks != nil && *bondConf.MinLinks > len(bondConf.Links) {
+		errs.add("minLinks", fmt.Errorf("minLinks should be between 0 and the number of links (%+v), actual: %+v", len(bondConf.Links), *bondConf.MinLinks))
+	}
+}
 
-	// get the namespace from the CNI_NETNS environment variable
-	netNs, err := netns.GetFromPath(nspath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve netNs from path (%+v), error: %+v", nspath, err)
+// return the number of peer notifications set by either numGratArp or numUnsolNa, or nil if neither is set
+func getNumPeerNotif(bondConf *bondingConfig) *int {
+	if bondConf.NumGratArp != nil {
+		return bondConf.NumGratArp
 	}
-	defer func() {
-		_ = netNs.Close()
-	}()
+	return bondConf.NumUnsolNa
+}
 
-	// get a handle for the namespace above, this handle will be used to interact with existing links and add a new one
-	netNsHandle, err := netlinksafe.NewHandleAt(netNs)
+// convert miimon to an int, a bond monitored by ARP may leave it unset. return miimon & error
+func getMiimon(bondConf *bondingConfig) (int, error) {
+	if bondConf.Miimon == "" && bondConf.ArpInterval != nil && *bondConf.ArpInterval > 0 {
+		return 0, nil
+	}
+
+	miimon, err := strconv.Atoi(bondConf.Miimon)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create a new handle at netNs (%+v), error: %+v", netNs, err)
+		return 0, fmt.Errorf("failed to convert bondMiimon value (%+v) to an int, error: %+v", bondConf.Miimon, err)
 	}
-	defer netNsHandle.Close()
+	return miimon, nil
+}
 
-	if !bondConf.LinksContNs {
-		if err := setLinksInNetNs(bondConf, nspath, false); err != nil {
-			return nil, fmt.Errorf("failed to move the links (%+v) in container network namespace, error: %+v", bondConf.Links, err)
+// keys of a link entry selecting the link by its attributes, deviceID is the PCI address passed by Multus
+var linkSelectorKeys = []string{"nameGlob", "mac", "altName", "alias", "driver", "pciAddress", "deviceID"}
+
+// report whether the link entry is resolved to a link name in the network namespace of the links
+func hasLinkSelector(link map[string]interface{}) bool {
+	for _, key := range linkSelectorKeys {
+		if _, ok := link[key]; ok {
+			return true
 		}
 	}
+	return false
+}
 
-	linkObjectsToBond, err := getLinkObjectsFromConfig(bondConf, &netNsHandle, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve link objects from configuration file (%+v), error: %+v", bondConf, err)
+// check a link entry selects its link either by name, by prevResult index or by attributes. return error
+func validateLinkSelector(link map[string]interface{}) error {
+	_, hasName := link["name"]
+	_, hasResultIndex := link["resultIndex"]
+	hasSelector := hasLinkSelector(link)
+	if hasName && (hasResultIndex || hasSelector) || hasResultIndex && hasSelector || !hasName && !hasResultIndex && !hasSelector {
+		return fmt.Errorf("link (%+v) should set either name, resultIndex or attribute selectors (%+v)", link, linkSelectorKeys)
+	}
+	if !hasSelector {
+		return nil
 	}
 
-	err = util.ValidateMTU(linkObjectsToBond, bondConf.MTU)
-	if err != nil {
-		return nil, err
+	_, err := linkSelectorFromConfig(link)
+	return err
+}
+
+// convert the attribute selectors of a link entry. return link selector & error
+func linkSelectorFromConfig(link map[string]interface{}) (*util.LinkSelector, error) {
+	values := map[string]string{}
+	for _, key := range linkSelectorKeys {
+		value, ok := link[key]
+		if !ok {
+			continue
+		}
+		stringValue, ok := value.(string)
+		if !ok || stringValue == "" {
+			return nil, fmt.Errorf("link %+v should be a non-empty string, actual: %+v", key, value)
+		}
+		values[key] = stringValue
 	}
 
-	bondLinkObj, err := createBondedLink(bondName, bondConf, &netNsHandle)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create bonded link (%+v), error: %+v", bondName, err)
+	if values["pciAddress"] != "" && values["deviceID"] != "" {
+		return nil, fmt.Errorf("link (%+v) should set only one of pciAddress or deviceID", link)
+	}
+	pciAddress := values["pciAddress"] + values["deviceID"]
+	if pciAddress != "" && !util.IsPCIAddress(pciAddress) {
+		return nil, fmt.Errorf("link PCI address should look like 0000:03:02.0, actual: %+v", pciAddress)
 	}
 
-	err = attachLinksToBond(bondLinkObj, linkObjectsToBond, &netNsHandle)
-	if err != nil {
-		return nil, fmt.Errorf("failed to attached links to bond, error: %+v", err)
+	if _, err := filepath.Match(values["nameGlob"], ""); err != nil {
+		return nil, fmt.Errorf("link nameGlob (%+v) is not a valid pattern, error: %+v", values["nameGlob"], err)
 	}
 
-	if err := netNsHandle.LinkSetUp(bondLinkObj); err != nil {
-		return nil, fmt.Errorf("failed to set bond link UP, error: %v", err)
+	var mac net.HardwareAddr
+	if values["mac"] != "" {
+		var err error
+		if mac, err = net.ParseMAC(values["mac"]); err != nil {
+			return nil, fmt.Errorf("link mac (%+v) is not a valid MAC address, error: %+v", values["mac"], err)
+		}
 	}
 
-	bond.Name = bondName
+	return &util.LinkSelector{
+		NameGlob:   values["nameGlob"],
+		MAC:        mac,
+		AltName:    values["altName"],
+		Alias:      values["alias"],
+		Driver:     values["driver"],
+		PCIAddress: pciAddress,
+	}, nil
+}
 
-	// Re-fetch interface to get all properties/attributes
-	contBond, err := netNsHandle.LinkByName(bond.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to refetch bond %q: %v", bond.Name, err)
+// resolve the links selected by attributes to their name in netNs, where the links currently are. return error
+func resolveLinkSelectors(bondConf *bondingConfig, netNs ns.NetNS) error {
+	hasSelectors := false
+	for _, link := range bondConf.Links {
+		hasSelectors = hasSelectors || hasLinkSelector(link)
 	}
-	bond.Mac = contBond.Attrs().HardwareAddr.String()
-	bond.Sandbox = ns.Path()
+	if !hasSelectors {
+		return nil
+	}
+
+	return netNs.Do(func(ns.NetNS) error {
+		selected := map[string]bool{}
+		for _, link := range bondConf.Links {
+			if !hasLinkSelector(link) {
+				selected[fmt.Sprint(link["name"])] = true
+				continue
+			}
+			selector, err := linkSelectorFromConfig(link)
+			if err != nil {
+				return err
+			}
+			linkObject, err := util.FindLink(selector)
+			if err != nil {
+				return err
+			}
 
-	return bond, nil
+			linkName := linkObject.Attrs().Name
+			if selected[linkName] {
+				return fmt.Errorf("link (%+v) is selected by more than one link entry", linkName)
+			}
+			selected[linkName] = true
+			link["name"] = linkName
+		}
+		return nil
+	})
 }
 
-func cmdAdd(args *skel.CmdArgs) error {
-	var err error
+// report whether the bondConf takes its links from prevResult, because it omits them or references them by index
+func linksFromPrevResult(bondConf *bondingConfig) bool {
+	if len(bondConf.Links) == 0 {
+		return true
+	}
+	for _, link := range bondConf.Links {
+		if _, ok := link["resultIndex"]; ok {
+			return true
+		}
+	}
+	return false
+}
 
-	bondConf, cniVersion, err := loadConfigFile(args.StdinData)
+// when chained, the links are the container interfaces created by the previous plugins: all of them when
+// the links are omitted, or those referenced by their index in prevResult. the prevResult of DEL and CHECK
+// also holds the bond ifName, which is never one of its links. return error
+func resolveLinksFromPrevResult(bondConf *bondingConfig, ifName string) error {
+	if bondConf.PrevResult == nil || !linksFromPrevResult(bondConf) {
+		return nil
+	}
+	prevResult, err := current.NewResultFromResult(bondConf.PrevResult)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to convert prevResult, error: %+v", err)
 	}
 
-	netns, err := ns.GetNS(args.Netns)
-	if err != nil {
+	if len(bondConf.Links) == 0 {
+		for _, intf := range prevResult.Interfaces {
+			if intf.Sandbox != "" && intf.Name != ifName {
+				bondConf.Links = append(bondConf.Links, map[string]interface{}{"name": intf.Name})
+			}
+		}
+	}
+
+	for _, link := range bondConf.Links {
+		index, ok := link["resultIndex"]
+		if !ok {
+			continue
+		}
+		// json numbers are decoded as float64
+		indexValue, ok := index.(float64)
+		if !ok || indexValue != float64(int(indexValue)) || int(indexValue) < 0 || int(indexValue) >= len(prevResult.Interfaces) {
+			return fmt.Errorf("link resultIndex (%+v) does not reference an interface of prevResult", index)
+		}
+
+		intf := prevResult.Interfaces[int(indexValue)]
+		if intf.Sandbox == "" {
+			return fmt.Errorf("prevResult interface (%+v) at resultIndex %+v is not in the container", intf.Name, index)
+		}
+		if intf.Name == ifName {
+			return fmt.Errorf("prevResult interface (%+v) at resultIndex %+v is the bond itself", intf.Name, index)
+		}
+		link["name"] = intf.Name
+	}
+
+	// the previous plugins already placed the links in the container
+	bondConf.LinksContNs = true
+	return nil
+}
+
+// retrieve the link names from the bondConf. return an array of linkNames & error
+func getLinkNamesFromConfig(bondConf *bondingConfig) ([]string, error) {
+	linkNames := []string{}
+	for _, linkName := range bondConf.Links {
+		s, ok := linkName["name"].(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to find link name")
+		}
+		linkNames = append(linkNames, s)
+	}
+
+	// currently supporting two or more links to one bond.
+	if len(linkNames) < 2 {
+		return nil, fmt.Errorf("bonding requires at least two links, we have %+v", len(linkNames))
+	}
+	return linkNames, nil
+}
+
+// retrieve the link names from the bondConf & check they exist. return an array of linkObjectsToBond & error
+func getLinkObjectsFromConfig(bondConf *bondingConfig, netNsHandle *netlinksafe.Handle, releaseLinks bool) ([]netlink.Link, error) {
+	linkNames, err := getLinkNamesFromConfig(bondConf)
+	if err != nil {
+		return nil, err
+	}
+
+	linkObjectsToBond := []netlink.Link{}
+	for _, linkName := range linkNames {
+		linkObject, err := netNsHandle.LinkByName(linkName)
+		if err != nil {
+			// Do not fail if device in container assigned to the bond has been deleted.
+			// This device might have been deleted by another plugin.
+			_, ok := err.(netlink.LinkNotFoundError)
+			if !ok || !releaseLinks {
+				return nil, fmt.Errorf("failed to confirm that link (%+v) exists, error: %+v", linkName, err)
+			}
+		} else {
+			linkObjectsToBond = append(linkObjectsToBond, linkObject)
+		}
+	}
+
+	return linkObjectsToBond, nil
+}
+
+// record the name, mac, mtu & admin state of the linkObjects before they are modified. return the slaves state
+func snapshotLinks(linkObjects []netlink.Link, inContainer bool) []util.SlaveState {
+	slaves := []util.SlaveState{}
+	for _, linkObject := range linkObjects {
+		slaves = append(slaves, util.SlaveState{
+			Name:        linkObject.Attrs().Name,
+			Mac:         linkObject.Attrs().HardwareAddr.String(),
+			MTU:         linkObject.Attrs().MTU,
+			AdminUp:     linkObject.Attrs().Flags&net.FlagUp != 0,
+			InContainer: inContainer,
+		})
+	}
+	return slaves
+}
+
+// build the bond object described by the bondConf, without adding it to any namespace. return a bondLinkObj pointer & error
+func newBondLinkObj(bondName string, bondConf *bondingConfig) (*netlink.Bond, error) {
+	var err error
+
+	bondLinkObj := netlink.NewLinkBond(netlink.NewLinkAttrs())
+	bondLinkObj.Attrs().Name = bondName
+
+	bondModeObj := netlink.StringToBondMode(bondConf.Mode)
+	bondLinkObj.Mode = bondModeObj
+
+	bondLinkObj.Miimon, err = getMiimon(bondConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if bondConf.MTU != 0 {
+		bondLinkObj.MTU = bondConf.MTU
+	}
+
+	bondLinkObj.FailOverMac = netlink.BondFailOverMac(bondConf.FailOverMac)
+
+	if bondConf.AllSlavesActive != nil {
+		bondLinkObj.AllSlavesActive = *bondConf.AllSlavesActive
+	}
+
+	if bondConf.TlbDynamicLb != nil {
+		bondLinkObj.TlbDynamicLb = *bondConf.TlbDynamicLb
+	}
+
+	if bondConf.XmitHashPolicy != nil {
+		bondLinkObj.XmitHashPolicy = netlink.StringToBondXmitHashPolicy(*bondConf.XmitHashPolicy)
+	}
+
+	if bondConf.ArpInterval != nil {
+		bondLinkObj.ArpInterval = *bondConf.ArpInterval
+	}
+
+	// an empty list clears the targets of an existing bond
+	if bondConf.ArpIpTargets != nil {
+		bondLinkObj.ArpIpTargets = []net.IP{}
+	}
+	for _, target := range bondConf.ArpIpTargets {
+		bondLinkObj.ArpIpTargets = append(bondLinkObj.ArpIpTargets, net.ParseIP(target))
+	}
+
+	if bondConf.ArpValidate != nil {
+		bondLinkObj.ArpValidate = arpValidateValues[*bondConf.ArpValidate]
+	}
+
+	if bondConf.ArpAllTargets != nil {
+		bondLinkObj.ArpAllTargets = netlink.StringToBondArpAllTargetsMap[*bondConf.ArpAllTargets]
+	}
+
+	if bondConf.UpDelay != nil {
+		bondLinkObj.UpDelay = *bondConf.UpDelay
+	}
+
+	if bondConf.DownDelay != nil {
+		bondLinkObj.DownDelay = *bondConf.DownDelay
+	}
+
+	if bondConf.PrimaryReselect != nil {
+		bondLinkObj.PrimaryReselect = netlink.StringToBondPrimaryReselectMap[*bondConf.PrimaryReselect]
+	}
+
+	if bondConf.MinLinks != nil {
+		bondLinkObj.MinLinks = *bondConf.MinLinks
+	}
+
+	if bondConf.PacketsPerSlave != nil {
+		bondLinkObj.PacketsPerSlave = *bondConf.PacketsPerSlave
+	}
+
+	if bondConf.LpInterval != nil {
+		bondLinkObj.LpInterval = *bondConf.LpInterval
+	}
+
+	if numPeerNotif := getNumPeerNotif(bondConf); numPeerNotif != nil {
+		bondLinkObj.NumPeerNotif = *numPeerNotif
+	}
+
+	if bondConf.ResendIgmp != nil {
+		bondLinkObj.ResendIgmp = *bondConf.ResendIgmp
+	}
+
+	if bondConf.LacpRate != nil {
+		bondLinkObj.LacpRate = netlink.StringToBondLacpRate(*bondConf.LacpRate)
+	}
+
+	if bondConf.AdSelect != nil {
+		bondLinkObj.AdSelect = netlink.StringToBondAdSelectMap[*bondConf.AdSelect]
+	}
+
+	if bondConf.AdActorSysPrio != nil {
+		bondLinkObj.AdActorSysPrio = *bondConf.AdActorSysPrio
+	}
+
+	if bondConf.AdUserPortKey != nil {
+		bondLinkObj.AdUserPortKey = *bondConf.AdUserPortKey
+	}
+
+	if bondConf.AdActorSystem != nil {
+		// validated by validateConfig
+		bondLinkObj.AdActorSystem, _ = net.ParseMAC(*bondConf.AdActorSystem)
+	}
+
+	return bondLinkObj, nil
+}
+
+// add the IPv4 gateways of the addresses of the interface at bondIndex to the ARP targets. return error
+func addArpTargetsFromResult(bondConf *bondingConfig, result *current.Result, bondIndex int) error {
+	found := false
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil || *ipc.Interface != bondIndex || ipc.Gateway == nil || ipc.Gateway.To4() == nil {
+			continue
+		}
+		found = true
+
+		if !slices.ContainsFunc(bondConf.ArpIpTargets, func(target string) bool { return net.ParseIP(target).Equal(ipc.Gateway) }) {
+			bondConf.ArpIpTargets = append(bondConf.ArpIpTargets, ipc.Gateway.String())
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("IPAM result holds no IPv4 gateway to use as ARP target")
+	}
+	if len(bondConf.ArpIpTargets) > maxArpIpTargets {
+		return fmt.Errorf("arpIpTargets and the IPAM gateways should hold at most %+v addresses, actual: %+v", maxArpIpTargets, len(bondConf.ArpIpTargets))
+	}
+	return nil
+}
+
+// add the gateways recorded by the previous attempt of a retried ADD to the ARP targets. return error
+func addArpTargetsFromRecordedResult(args *skel.CmdArgs, bondConf *bondingConfig, state *util.AttachmentState) error {
+	result, err := current.NewResult(state.Result)
+	if err != nil {
+		return fmt.Errorf("failed to parse the result recorded on ADD, error: %+v", err)
+	}
+	currentResult := result.(*current.Result)
+
+	for i, intf := range currentResult.Interfaces {
+		if intf.Name == args.IfName && intf.Sandbox == args.Netns {
+			return addArpTargetsFromResult(bondConf, currentResult, i)
+		}
+	}
+	return fmt.Errorf("bond (%+v) not found in the result recorded on ADD", args.IfName)
+}
+
+// replace the ARP targets of a bond that is already up. return error
+func setBondArpIpTargets(nspath string, bondName string, bondConf *bondingConfig) error {
+	return doWithNetNsHandle(nspath, func(netNsHandle *netlinksafe.Handle) error {
+		link, err := netNsHandle.LinkByName(bondName)
+		if err != nil {
+			return fmt.Errorf("failed to find bonded link (%+v), error: %+v", bondName, err)
+		}
+
+		// every other option is left unset so it is not changed
+		bondLinkObj := netlink.NewLinkBond(netlink.NewLinkAttrs())
+		bondLinkObj.Name = bondName
+		bondLinkObj.Index = link.Attrs().Index
+		for _, target := range bondConf.ArpIpTargets {
+			bondLinkObj.ArpIpTargets = append(bondLinkObj.ArpIpTargets, net.ParseIP(target))
+		}
+
+		if err = netNsHandle.LinkModify(bondLinkObj); err != nil {
+			return fmt.Errorf("failed to set ARP targets (%+v) of bonded link (%+v), error: %+v", bondConf.ArpIpTargets, bondName, err)
+		}
+		return nil
+	})
+}
+
+// set the primary and the initial active slave, which can only reference links enslaved to the bond. return error
+func setPrimaryAndActiveSlave(bondLinkObj *netlink.Bond, linkObjectsToBond []netlink.Link, bondConf *bondingConfig, netNsHandle *netlinksafe.Handle) error {
+	if bondConf.Primary == nil && bondConf.ActiveSlave == nil {
+		return nil
+	}
+
+	// every other option is left unset so it is not changed
+	bondSlavesObj := netlink.NewLinkBond(netlink.NewLinkAttrs())
+	bondSlavesObj.Name = bondLinkObj.Name
+	bondSlavesObj.Index = bondLinkObj.Index
+	if bondConf.Primary != nil {
+		bondSlavesObj.Primary = linkObjectsToBond[*bondConf.Primary].Attrs().Index
+	}
+	if bondConf.ActiveSlave != nil {
+		bondSlavesObj.ActiveSlave = linkObjectsToBond[*bondConf.ActiveSlave].Attrs().Index
+	}
+
+	if err := netNsHandle.LinkModify(bondSlavesObj); err != nil {
+		return fmt.Errorf("failed to set primary and active slave of bonded link (%+v), error: %+v", bondLinkObj.Name, err)
+	}
+	return nil
+}
+
+// set the options of the bond at bondIndex which have no field in netlink.Bond, then read the bond back to check
+// the running kernel knows every option set. return error
+func setExtraBondOptions(nspath string, bondIndex int, bondConf *bondingConfig) error {
+	options := []*nl.RtAttr{}
+	if bondConf.ArpMissedMax != nil {
+		options = append(options, nl.NewRtAttr(unix.IFLA_BOND_MISSED_MAX, nl.Uint8Attr(uint8(*bondConf.ArpMissedMax))))
+	}
+	if bondConf.PeerNotifDelay != nil {
+		options = append(options, nl.NewRtAttr(unix.IFLA_BOND_PEER_NOTIF_DELAY, nl.Uint32Attr(uint32(*bondConf.PeerNotifDelay))))
+	}
+	if bondConf.LacpActive != nil {
+		options = append(options, nl.NewRtAttr(unix.IFLA_BOND_AD_LACP_ACTIVE, nl.Uint8Attr(lacpActiveValues[*bondConf.LacpActive])))
+	}
+	// an empty list clears the targets of an existing bond
+	if bondConf.NsIp6Targets != nil {
+		targets := nl.NewRtAttr(unix.IFLA_BOND_NS_IP6_TARGET, nil)
+		for i, target := range bondConf.NsIp6Targets {
+			targets.AddRtAttr(i, net.ParseIP(target).To16())
+		}
+		options = append(options, targets)
+	}
+	if len(options) > 0 {
+		if err := util.SetBondOptions(nspath, bondIndex, options); err != nil {
+			return err
+		}
+	}
+
+	return checkKernelSupport(nspath, bondIndex, bondConf)
+}
+
+// check the running kernel applied every configured option it may not know, reading them back from the bond
+// at bondIndex rather than guessing from the kernel version, as distributions backport options. return error
+func checkKernelSupport(nspath string, bondIndex int, bondConf *bondingConfig) error {
+	needsCheck := false
+	for _, rule := range bondOptionRules {
+		if rule.attribute != 0 && rule.configured(bondConf) {
+			needsCheck = true
+			break
+		}
+	}
+	if !needsCheck {
+		return nil
+	}
+
+	attributes, err := util.GetBondOptions(nspath, bondIndex)
+	if err != nil {
+		return err
+	}
+	kernel := "unknown version"
+	if version, err := util.GetKernelVersion(); err == nil {
+		kernel = version.String()
+	}
+	errs := &configErrors{}
+	validateKernelSupport(bondConf, attributes, kernel, errs)
+	return errs.asError()
+}
+
+// configure the bonded link & add it using the netNsHandle context to add it to the required namespace at nspath.
+// the bond is deleted again when the running kernel does not support its options. return a bondLinkObj pointer & error
+func createBondedLink(bondName string, bondConf *bondingConfig, nspath string, netNsHandle *netlinksafe.Handle) (*netlink.Bond, error) {
+	bondLinkObj, err := newBondLinkObj(bondName, bondConf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = netNsHandle.LinkAdd(bondLinkObj)
+	if err != nil {
+		// older kernels refuse the xmit hash policies they do not know without naming the option
+		if errors.Is(err, unix.EINVAL) {
+			if version, versionErr := util.GetKernelVersion(); versionErr == nil {
+				errs := &configErrors{}
+				validateXmitHashPolicySupport(bondConf, version, errs)
+				if policyErr := errs.asError(); policyErr != nil {
+					return nil, policyErr
+				}
+			}
+		}
+		return nil, fmt.Errorf("failed to add link (%+v) to the netNsHandle, error: %+v", bondLinkObj.Attrs().Name, err)
+	}
+
+	if err = setExtraBondOptions(nspath, bondLinkObj.Index, bondConf); err != nil {
+		if delErr := netNsHandle.LinkDel(bondLinkObj); delErr != nil {
+			return nil, fmt.Errorf("%w, failed to delete bonded link (%+v), error: %+v", err, bondName, delErr)
+		}
+		return nil, err
+	}
+
+	return bondLinkObj, nil
+}
+
+// loop over the linkObjectsToBond, set each DOWN, update the interface MASTER & set it UP again.
+// again we use the netNsHandle to interfact with these links in the namespace provided. return error
+func attachLinksToBond(bondLinkObj *netlink.Bond, linkObjectsToBond []netlink.Link, netNsHandle *netlinksafe.Handle) error {
+	err := util.HandleMacDuplicates(linkObjectsToBond, netNsHandle)
+	if err != nil {
+		return fmt.Errorf("failed to handle duplicated macs on link slaves, error: %+v", err)
+	}
+
+	bondLinkIndex := bondLinkObj.Index
+	for _, linkObject := range linkObjectsToBond {
+		err = netNsHandle.LinkSetDown(linkObject)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v DOWN, error: %+v", linkObject.Attrs().Name, err)
+		}
+		err = netNsHandle.LinkSetMasterByIndex(linkObject, bondLinkIndex)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v MASTER, master index used: %+v, error: %+v", linkObject.Attrs().Name, bondLinkIndex, err)
+		}
+		err = netNsHandle.LinkSetUp(linkObject)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v UP, error: %+v", linkObject.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+// loop over the linkObjectsToDeattach, set each DOWN, update the interface MASTER to nomaster & set it UP again.
+// again we use the netNsHandle to interfact with these links in the namespace provided. return error
+func deattachLinksFromBond(linkObjectsToDeattach []netlink.Link, netNsHandle *netlinksafe.Handle) error {
+	var err error
+
+	for _, linkObject := range linkObjectsToDeattach {
+		err = netNsHandle.LinkSetDown(linkObject)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v DOWN, error: %+v", linkObject.Attrs().Name, err)
+		}
+		err = netNsHandle.LinkSetNoMaster(linkObject)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v NOMASTER, error: %+v", linkObject.Attrs().Name, err)
+		}
+		err = netNsHandle.LinkSetUp(linkObject)
+		if err != nil {
+			return fmt.Errorf("failed to set link: %+v UP, error: %+v", linkObject.Attrs().Name, err)
+		}
+	}
+	return nil
+}
+
+// revert the mac, mtu & optionally the admin state of released slaves to what was recorded before they were enslaved.
+// again we use the netNsHandle to interfact with these links in the namespace provided. return error
+func restoreSlaves(slaves []util.SlaveState, netNsHandle *netlinksafe.Handle, restoreAdminState bool) error {
+	for _, slave := range slaves {
+		linkObject, err := netNsHandle.LinkByName(slave.Name)
+		if err != nil {
+			// the link might have been deleted by another plugin, there is nothing to restore
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				continue
+			}
+			return fmt.Errorf("failed to find link (%+v), error: %+v", slave.Name, err)
+		}
+
+		// links without a recorded mac keep the one they have
+		mac, _ := net.ParseMAC(slave.Mac)
+		macChanged := mac != nil && !bytes.Equal(mac, linkObject.Attrs().HardwareAddr)
+		mtuChanged := slave.MTU != 0 && slave.MTU != linkObject.Attrs().MTU
+
+		if macChanged || mtuChanged {
+			if err = netNsHandle.LinkSetDown(linkObject); err != nil {
+				return fmt.Errorf("failed to set link: %+v DOWN, error: %+v", slave.Name, err)
+			}
+		}
+		if macChanged {
+			if err = netNsHandle.LinkSetHardwareAddr(linkObject, mac); err != nil {
+				return fmt.Errorf("failed to restore link: %+v mac %+v, error: %+v", slave.Name, slave.Mac, err)
+			}
+		}
+		if mtuChanged {
+			if err = netNsHandle.LinkSetMTU(linkObject, slave.MTU); err != nil {
+				return fmt.Errorf("failed to restore link: %+v mtu %+v, error: %+v", slave.Name, slave.MTU, err)
+			}
+		}
+
+		if !restoreAdminState {
+			continue
+		}
+		if slave.AdminUp {
+			err = netNsHandle.LinkSetUp(linkObject)
+		} else {
+			err = netNsHandle.LinkSetDown(linkObject)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore link: %+v admin state, error: %+v", slave.Name, err)
+		}
+	}
+	return nil
+}
+
+func setLinksInNetNs(bondConf *bondingConfig, nspath string, releaseLinks bool) error {
+	linkNames, err := getLinkNamesFromConfig(bondConf)
+	if err != nil {
+		return err
+	}
+	return setNamedLinksInNetNs(linkNames, nspath, releaseLinks)
+}
+
+// move the links named linkNames from the host to the network namespace at nspath, or back when releaseLinks is set.
+// return error
+func setNamedLinksInNetNs(linkNames []string, nspath string, releaseLinks bool) error {
+	var podNs, hostNS ns.NetNS
+	var err error
+
+	if podNs, err = ns.GetNS(nspath); err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", nspath, err)
+	}
+	defer func() {
+		_ = podNs.Close()
+	}()
+
+	if hostNS, err = ns.GetCurrentNS(); err != nil {
+		return fmt.Errorf("failed to get init netns: %v", err)
+	}
+
+	if releaseLinks {
+		return moveLinksBetweenNs(linkNames, podNs, hostNS, "host")
+	}
+	return moveLinksBetweenNs(linkNames, hostNS, podNs, "container")
+}
+
+func moveLinksBetweenNs(links []string, from ns.NetNS, to ns.NetNS, toNsName string) error {
+	movedLinks := []string{}
+	err := from.Do(func(ns.NetNS) error {
+		for _, linkName := range links {
+			// get interface link in the network namespace
+			link, err := netlink.LinkByName(linkName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup link interface %q: %v", linkName, err)
+			}
+
+			// set link interface down
+			if err = netlink.LinkSetDown(link); err != nil {
+				return fmt.Errorf("failed to down link interface %q: %v", linkName, err)
+			}
+
+			// move link interface to network netns
+			if err = netlink.LinkSetNsFd(link, int(to.Fd())); err != nil {
+				return fmt.Errorf("failed to move link interface to %s netns %q: %v", toNsName, linkName, err)
+			}
+			movedLinks = append(movedLinks, linkName)
+		}
+		return nil
+	})
+	if err == nil || len(movedLinks) == 0 {
+		return err
+	}
+
+	// do not leave the links split between namespaces, return the ones already moved
+	revertErr := to.Do(func(ns.NetNS) error {
+		for _, linkName := range movedLinks {
+			link, err := netlink.LinkByName(linkName)
+			if err != nil {
+				return fmt.Errorf("failed to lookup link interface %q: %v", linkName, err)
+			}
+			if err = netlink.LinkSetNsFd(link, int(from.Fd())); err != nil {
+				return fmt.Errorf("failed to move back link interface %q: %v", linkName, err)
+			}
+		}
+		return nil
+	})
+	if revertErr != nil {
+		return fmt.Errorf("%v, failed to revert moved links: %v", err, revertErr)
+	}
+	return err
+}
+
+// open a netlink handle in the namespace at nspath & run fn with it. return error
+func doWithNetNsHandle(nspath string, fn func(netNsHandle *netlinksafe.Handle) error) error {
+	netNs, err := netns.GetFromPath(nspath)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve netNs from path (%+v), error: %+v", nspath, err)
+	}
+	defer func() {
+		_ = netNs.Close()
+	}()
+
+	netNsHandle, err := netlinksafe.NewHandleAt(netNs)
+	if err != nil {
+		return fmt.Errorf("failed to create a new handle at netNs (%+v), error: %+v", netNs, err)
+	}
+	defer netNsHandle.Close()
+
+	return fn(&netNsHandle)
+}
+
+func createBond(bondName string, bondConf *bondingConfig, nspath string, ns ns.NetNS, tx *addTransaction) (*current.Interface, []util.SlaveState, error) {
+	bond := &current.Interface{}
+
+	// get the namespace from the CNI_NETNS environment variable
+	netNs, err := netns.GetFromPath(nspath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve netNs from path (%+v), error: %+v", nspath, err)
+	}
+	defer func() {
+		_ = netNs.Close()
+	}()
+
+	// get a handle for the namespace above, this handle will be used to interact with existing links and add a new one
+	netNsHandle, err := netlinksafe.NewHandleAt(netNs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create a new handle at netNs (%+v), error: %+v", netNs, err)
+	}
+	defer netNsHandle.Close()
+
+	linksHandle := &netNsHandle
+	if !bondConf.LinksContNs {
+		hostHandle, err := netlinksafe.NewHandle()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create a new handle, error: %+v", err)
+		}
+		defer hostHandle.Close()
+		linksHandle = &hostHandle
+	}
+	linkObjectsToSnapshot, err := getLinkObjectsFromConfig(bondConf, linksHandle, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve link objects from configuration file (%+v), error: %+v", bondConf, err)
+	}
+	slaves := snapshotLinks(linkObjectsToSnapshot, bondConf.LinksContNs)
+
+	if !bondConf.LinksContNs {
+		if err := setLinksInNetNs(bondConf, nspath, false); err != nil {
+			return nil, nil, fmt.Errorf("failed to move the links (%+v) in container network namespace, error: %+v", bondConf.Links, err)
+		}
+		tx.record(func() error {
+			if err := setLinksInNetNs(bondConf, nspath, true); err != nil {
+				return fmt.Errorf("failed to return links (%+v) to host network namespace, error: %+v", bondConf.Links, err)
+			}
+			hostHandle, err := netlinksafe.NewHandle()
+			if err != nil {
+				return fmt.Errorf("failed to create a new handle, error: %+v", err)
+			}
+			defer hostHandle.Close()
+			return restoreSlaves(slaves, &hostHandle, true)
+		})
+	}
+
+	linkObjectsToBond, err := getLinkObjectsFromConfig(bondConf, &netNsHandle, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve link objects from configuration file (%+v), error: %+v", bondConf, err)
+	}
+
+	err = util.ValidateMTU(linkObjectsToBond, bondConf.MTU)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bondLinkObj, err := createBondedLink(bondName, bondConf, nspath, &netNsHandle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create bonded link (%+v), error: %w", bondName, err)
+	}
+	tx.record(func() error {
+		return doWithNetNsHandle(nspath, func(netNsHandle *netlinksafe.Handle) error {
+			if err := netNsHandle.LinkDel(bondLinkObj); err != nil {
+				return fmt.Errorf("failed to delete bonded link (%+v), error: %+v", bondName, err)
+			}
+			return nil
+		})
+	})
+
+	tx.record(func() error {
+		return doWithNetNsHandle(nspath, func(netNsHandle *netlinksafe.Handle) error {
+			if err := deattachLinksFromBond(linkObjectsToBond, netNsHandle); err != nil {
+				return fmt.Errorf("failed to deattach links from bond, error: %+v", err)
+			}
+			return restoreSlaves(slaves, netNsHandle, bondConf.LinksContNs)
+		})
+	})
+	err = attachLinksToBond(bondLinkObj, linkObjectsToBond, &netNsHandle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to attached links to bond, error: %+v", err)
+	}
+
+	if err := netNsHandle.LinkSetUp(bondLinkObj); err != nil {
+		return nil, nil, fmt.Errorf("failed to set bond link UP, error: %v", err)
+	}
+
+	if err = setPrimaryAndActiveSlave(bondLinkObj, linkObjectsToBond, bondConf, &netNsHandle); err != nil {
+		return nil, nil, err
+	}
+
+	if err = verifyAppliedBondOptions(bondName, bondConf, &netNsHandle); err != nil {
+		return nil, nil, err
+	}
+
+	bond.Name = bondName
+
+	// Re-fetch interface to get all properties/attributes
+	contBond, err := netNsHandle.LinkByName(bond.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refetch bond %q: %v", bond.Name, err)
+	}
+	bond.Mac = contBond.Attrs().HardwareAddr.String()
+	bond.Sandbox = ns.Path()
+
+	return bond, slaves, nil
+}
+
+// the kernel silently ignores some options depending on the mode and the order they are set in,
+// so re-read the bond once its slaves are attached and compare it with the bondConf. return error
+func verifyAppliedBondOptions(bondName string, bondConf *bondingConfig, netNsHandle *netlinksafe.Handle) error {
+	link, err := netNsHandle.LinkByName(bondName)
+	if err != nil {
+		return fmt.Errorf("failed to re-read bonded link (%+v), error: %+v", bondName, err)
+	}
+	bondLinkObj, ok := link.(*netlink.Bond)
+	if !ok {
+		return fmt.Errorf("link (%+v) is not a bond, actual type: %+v", bondName, link.Type())
+	}
+	if err = validateBondConf(bondLinkObj, bondConf); err != nil {
+		return fmt.Errorf("bond (%+v) options were not applied as configured, error: %+v", bondName, err)
+	}
+	return nil
+}
+
+// look up the links by name with the netNsHandle. return an array of linkObjects & error
+func getLinkObjectsByName(linkNames []string, netNsHandle *netlinksafe.Handle) ([]netlink.Link, error) {
+	linkObjects := []netlink.Link{}
+	for _, linkName := range linkNames {
+		linkObject, err := netNsHandle.LinkByName(linkName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm that link (%+v) exists, error: %+v", linkName, err)
+		}
+		linkObjects = append(linkObjects, linkObject)
+	}
+	return linkObjects, nil
+}
+
+// bring the bond left by a previous ADD of the same attachment in line with the bondConf, so a retried ADD
+// succeeds instead of failing on the existing bond. every step is recorded in tx, a failed retry leaves the bond
+// as the previous ADD recorded it. return the updated state, or nil if there is no bond to reconcile
+func reconcileExistingBond(args *skel.CmdArgs, bondConf *bondingConfig, state *util.AttachmentState, podNs ns.NetNS, tx *addTransaction) (*util.AttachmentState, error) {
+	linkNames, err := getLinkNamesFromConfig(bondConf)
+	if err != nil {
+		return nil, err
+	}
+
+	var bondLinkObj *netlink.Bond
+	missingLinks := []string{}
+	err = doWithNetNsHandle(args.Netns, func(netNsHandle *netlinksafe.Handle) error {
+		link, err := netNsHandle.LinkByName(args.IfName)
+		if err != nil {
+			if _, ok := err.(netlink.LinkNotFoundError); ok {
+				return nil
+			}
+			return fmt.Errorf("failed to find bonded link (%+v), error: %+v", args.IfName, err)
+		}
+
+		var ok bool
+		if bondLinkObj, ok = link.(*netlink.Bond); !ok {
+			return fmt.Errorf("link (%+v) already exists and is not a bond", args.IfName)
+		}
+
+		for _, linkName := range linkNames {
+			if _, err := netNsHandle.LinkByName(linkName); err != nil {
+				if _, ok := err.(netlink.LinkNotFoundError); !ok {
+					return fmt.Errorf("failed to lookup link interface %q: %v", linkName, err)
+				}
+				missingLinks = append(missingLinks, linkName)
+			}
+		}
+		return nil
+	})
+	if err != nil || bondLinkObj == nil {
+		return nil, err
+	}
+
+	// options set by the previous ADD and since removed from the configuration go back to their kernel default,
+	// and the options added since go back to their default when the retry is rolled back
+	prevConf, _, err := loadConfigFile(state.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the configuration recorded on ADD, error: %+v", err)
+	}
+	effectiveConf := *bondConf
+	optionsReset := resetRemovedOptions(&effectiveConf, prevConf)
+	clearPrimary := prevConf.Primary != nil && bondConf.Primary == nil
+	prevEffectiveConf := *prevConf
+	resetRemovedOptions(&prevEffectiveConf, bondConf)
+
+	hostNs, err := ns.GetCurrentNS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get init netns: %v", err)
+	}
+	defer func() {
+		_ = hostNs.Close()
+	}()
+
+	recordedSlaves := map[string]util.SlaveState{}
+	for _, slave := range state.Slaves {
+		recordedSlaves[slave.Name] = slave
+	}
+
+	// links added to the configuration since the previous ADD are still in the host
+	if len(missingLinks) > 0 {
+		if bondConf.LinksContNs {
+			return nil, fmt.Errorf("failed to confirm that links (%+v) exist in container network namespace", missingLinks)
+		}
+
+		hostHandle, err := netlinksafe.NewHandle()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a new handle, error: %+v", err)
+		}
+		linkObjects, err := getLinkObjectsByName(missingLinks, &hostHandle)
+		hostHandle.Close()
+		if err != nil {
+			return nil, err
+		}
+		missingSlaves := snapshotLinks(linkObjects, false)
+		for _, slave := range missingSlaves {
+			recordedSlaves[slave.Name] = slave
+		}
+
+		if err = moveLinksBetweenNs(missingLinks, hostNs, podNs, "container"); err != nil {
+			return nil, fmt.Errorf("failed to move the links (%+v) in container network namespace, error: %+v", missingLinks, err)
+		}
+		tx.record(func() error {
+			if err := setNamedLinksInNetNs(missingLinks, args.Netns, true); err != nil {
+				return fmt.Errorf("failed to return links (%+v) to host network namespace, error: %+v", missingLinks, err)
+			}
+			hostHandle, err := netlinksafe.NewHandle()
+			if err != nil {
+				return fmt.Errorf("failed to create a new handle, error: %+v", err)
+			}
+			defer hostHandle.Close()
+			return restoreSlaves(missingSlaves, &hostHandle, true)
+		})
+	}
+
+	releasedSlaves := []util.SlaveState{}
+	err = doWithNetNsHandle(args.Netns, func(netNsHandle *netlinksafe.Handle) error {
+		linkObjectsToBond, err := getLinkObjectsByName(linkNames, netNsHandle)
+		if err != nil {
+			return err
+		}
+
+		if err = util.ValidateMTU(linkObjectsToBond, bondConf.MTU); err != nil {
+			return err
+		}
+
+		configuredLinks := map[string]bool{}
+		for _, linkName := range linkNames {
+			configuredLinks[linkName] = true
+		}
+
+		allLinks, err := netNsHandle.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list links, error: %+v", err)
+		}
+		currentSlaves := []netlink.Link{}
+		currentSlaveNames := []string{}
+		staleSlaves := []netlink.Link{}
+		for _, link := range allLinks {
+			if link.Attrs().MasterIndex != bondLinkObj.Index {
+				continue
+			}
+			if configuredLinks[link.Attrs().Name] {
+				currentSlaves = append(currentSlaves, link)
+				currentSlaveNames = append(currentSlaveNames, link.Attrs().Name)
+			} else {
+				staleSlaves = append(staleSlaves, link)
+			}
+		}
+
+		if err = deattachLinksFromBond(staleSlaves, netNsHandle); err != nil {
+			return fmt.Errorf("failed to deattach links from bond, error: %+v", err)
+		}
+		staleSlaveNames := []string{}
+		for _, link := range staleSlaves {
+			staleSlaveNames = append(staleSlaveNames, link.Attrs().Name)
+		}
+		if len(staleSlaveNames) > 0 {
+			tx.record(func() error {
+				return doWithNetNsHandle(args.Netns, func(netNsHandle *netlinksafe.Handle) error {
+					linkObjects, err := getLinkObjectsByName(staleSlaveNames, netNsHandle)
+					if err != nil {
+						return err
+					}
+					return attachLinksToBond(bondLinkObj, linkObjects, netNsHandle)
+				})
+			})
+		}
+		for _, link := range staleSlaves {
+			if slave, ok := recordedSlaves[link.Attrs().Name]; ok {
+				releasedSlaves = append(releasedSlaves, slave)
+				delete(recordedSlaves, slave.Name)
+			}
+		}
+		if err = restoreSlaves(releasedSlaves, netNsHandle, bondConf.LinksContNs); err != nil {
+			return fmt.Errorf("failed to restore deattached links, error: %+v", err)
+		}
+
+		// most bond options can only be changed while the bond is down and has no slaves
+		reconfigured := optionsReset || clearPrimary || validateBondConf(bondLinkObj, &effectiveConf) != nil
+		if reconfigured {
+			if err = netNsHandle.LinkSetDown(bondLinkObj); err != nil {
+				return fmt.Errorf("failed to set bonded link: %+v DOWN, error: %+v", args.IfName, err)
+			}
+			if err = deattachLinksFromBond(currentSlaves, netNsHandle); err != nil {
+				return fmt.Errorf("failed to deattach links from bond, error: %+v", err)
+			}
+
+			reconciledBond, err := newBondLinkObj(args.IfName, &effectiveConf)
+			if err != nil {
+				return err
+			}
+			reconciledBond.Index = bondLinkObj.Index
+			if clearPrimary {
+				// no link has index 0, which clears the primary
+				reconciledBond.Primary = 0
+			}
+			if err = netNsHandle.LinkModify(reconciledBond); err != nil {
+				return fmt.Errorf("failed to update bonded link (%+v), error: %+v", args.IfName, err)
+			}
+			tx.record(func() error {
+				return doWithNetNsHandle(args.Netns, func(netNsHandle *netlinksafe.Handle) error {
+					return restoreBondOptions(args, bondLinkObj, &prevEffectiveConf, state.Links, currentSlaveNames, netNsHandle)
+				})
+			})
+		}
+		if err = setExtraBondOptions(args.Netns, bondLinkObj.Index, &effectiveConf); err != nil {
+			return err
+		}
+
+		// re-fetch the links, the slaves might just have been released
+		if linkObjectsToBond, err = getLinkObjectsByName(linkNames, netNsHandle); err != nil {
+			return err
+		}
+		linkObjectsToAttach := []netlink.Link{}
+		addedLinks := []netlink.Link{}
+		addedSlaves := []util.SlaveState{}
+		for _, linkObject := range linkObjectsToBond {
+			if linkObject.Attrs().MasterIndex == bondLinkObj.Index {
+				continue
+			}
+			if _, ok := recordedSlaves[linkObject.Attrs().Name]; !ok {
+				recordedSlaves[linkObject.Attrs().Name] = snapshotLinks([]netlink.Link{linkObject}, true)[0]
+			}
+			if !slices.Contains(currentSlaveNames, linkObject.Attrs().Name) {
+				addedLinks = append(addedLinks, linkObject)
+				addedSlaves = append(addedSlaves, recordedSlaves[linkObject.Attrs().Name])
+			}
+			linkObjectsToAttach = append(linkObjectsToAttach, linkObject)
+		}
+
+		if len(addedLinks) > 0 {
+			tx.record(func() error {
+				return doWithNetNsHandle(args.Netns, func(netNsHandle *netlinksafe.Handle) error {
+					if err := deattachLinksFromBond(addedLinks, netNsHandle); err != nil {
+						return fmt.Errorf("failed to deattach links from bond, error: %+v", err)
+					}
+					return restoreSlaves(addedSlaves, netNsHandle, bondConf.LinksContNs)
+				})
+			})
+		}
+		if err = attachLinksToBond(bondLinkObj, linkObjectsToAttach, netNsHandle); err != nil {
+			return fmt.Errorf("failed to attached links to bond, error: %+v", err)
+		}
+
+		if err = netNsHandle.LinkSetUp(bondLinkObj); err != nil {
+			return fmt.Errorf("failed to set bond link UP, error: %v", err)
+		}
+		// the active slave is only the initial one, a retry must not fail the bond over unless its slaves were detached
+		slavesConf := effectiveConf
+		if !reconfigured {
+			slavesConf.ActiveSlave = nil
+		}
+		if err = setPrimaryAndActiveSlave(bondLinkObj, linkObjectsToBond, &slavesConf, netNsHandle); err != nil {
+			return err
+		}
+		return verifyAppliedBondOptions(args.IfName, &effectiveConf, netNsHandle)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// slaves taken from the host by the previous ADD go back to it
+	hostSlaves := []util.SlaveState{}
+	hostSlaveNames := []string{}
+	for _, slave := range releasedSlaves {
+		if !slave.InContainer {
+			hostSlaves = append(hostSlaves, slave)
+			hostSlaveNames = append(hostSlaveNames, slave.Name)
+		}
+	}
+	if len(hostSlaves) > 0 {
+		if err = moveLinksBetweenNs(hostSlaveNames, podNs, hostNs, "host"); err != nil {
+			return nil, fmt.Errorf("failed set links (%+v) in host network namespace, error: %+v", hostSlaveNames, err)
+		}
+		tx.record(func() error {
+			if err := setNamedLinksInNetNs(hostSlaveNames, args.Netns, false); err != nil {
+				return fmt.Errorf("failed to move the links (%+v) back in container network namespace, error: %+v", hostSlaveNames, err)
+			}
+			return nil
+		})
+
+		hostHandle, err := netlinksafe.NewHandle()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a new handle, error: %+v", err)
+		}
+		defer hostHandle.Close()
+		if err = restoreSlaves(hostSlaves, &hostHandle, true); err != nil {
+			return nil, fmt.Errorf("failed to restore links returned to host network namespace, error: %+v", err)
+		}
+	}
+
+	reconciledState := *state
+	reconciledState.Config = args.StdinData
+	reconciledState.Links = linkNames
+	reconciledState.Slaves = []util.SlaveState{}
+	for _, linkName := range linkNames {
+		if slave, ok := recordedSlaves[linkName]; ok {
+			reconciledState.Slaves = append(reconciledState.Slaves, slave)
+		}
+	}
+	return &reconciledState, nil
+}
+
+// undo the option changes of a retried ADD: set the bond back to the prevConf recorded by the previous ADD, whose
+// link entries were resolved to prevLinkNames, and attach the slaves it kept again. return error
+func restoreBondOptions(args *skel.CmdArgs, bondLinkObj *netlink.Bond, prevConf *bondingConfig, prevLinkNames, slaveNames []string, netNsHandle *netlinksafe.Handle) error {
+	slaves, err := getLinkObjectsByName(slaveNames, netNsHandle)
+	if err != nil {
+		return err
+	}
+	if err = netNsHandle.LinkSetDown(bondLinkObj); err != nil {
+		return fmt.Errorf("failed to set bonded link: %+v DOWN, error: %+v", args.IfName, err)
+	}
+	if err = deattachLinksFromBond(slaves, netNsHandle); err != nil {
+		return fmt.Errorf("failed to deattach links from bond, error: %+v", err)
+	}
+
+	prevBond, err := newBondLinkObj(args.IfName, prevConf)
+	if err != nil {
+		return err
+	}
+	prevBond.Index = bondLinkObj.Index
+	if err = netNsHandle.LinkModify(prevBond); err != nil {
+		return fmt.Errorf("failed to restore bonded link (%+v), error: %+v", args.IfName, err)
+	}
+	if err = setExtraBondOptions(args.Netns, bondLinkObj.Index, prevConf); err != nil {
+		return err
+	}
+
+	if err = attachLinksToBond(bondLinkObj, slaves, netNsHandle); err != nil {
+		return fmt.Errorf("failed to attached links to bond, error: %+v", err)
+	}
+	if err = netNsHandle.LinkSetUp(bondLinkObj); err != nil {
+		return fmt.Errorf("failed to set bond link UP, error: %v", err)
+	}
+
+	// the active slave is only the initial one, the primary is all there is to restore
+	if prevConf.Primary == nil || *prevConf.Primary >= len(prevLinkNames) {
+		return nil
+	}
+	prevLinks, err := getLinkObjectsByName(prevLinkNames, netNsHandle)
+	if err != nil {
+		return err
+	}
+	primaryConf := *prevConf
+	primaryConf.ActiveSlave = nil
+	return setPrimaryAndActiveSlave(bondLinkObj, prevLinks, &primaryConf, netNsHandle)
+}
+
+// make sure the bonding driver is loaded, or can be loaded on demand, before the bond is created.
+// the module is loaded first when the configuration asks for it. return error
+func ensureBondingModule(bondConf *bondingConfig) error {
+	if util.IsBondingModuleLoaded() {
+		return nil
+	}
+
+	if bondConf.LoadBondingModule {
+		if err := util.LoadBondingModule(); err != nil {
+			return types.NewError(errBondingModuleUnavailable, "failed to load the bonding kernel module",
+				fmt.Sprintf("%+v, load it on the node with \"modprobe bonding\"", err))
+		}
+		return nil
+	}
+
+	capabilities, err := util.ProbeKernelCapabilities()
+	if err != nil {
+		return types.NewError(errBondingModuleUnavailable, "failed to detect the bonding kernel module", err.Error())
+	}
+	if !capabilities.BondingModuleAvailable {
+		return types.NewError(errBondingModuleUnavailable, "bonding kernel module is not available",
+			fmt.Sprintf("the module is neither loaded nor found for kernel %+v, load it on the node with \"modprobe bonding\"", capabilities.Version))
+	}
+	return nil
+}
+
+func cmdAdd(args *skel.CmdArgs) (retErr error) {
+	bondConf, cniVersion, err := loadAddConfig(args.StdinData, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	tx := &addTransaction{}
+	defer func() {
+		if retErr != nil {
+			retErr = tx.rollback(retErr)
+		}
+	}()
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
 		return fmt.Errorf("failed to open netns %q: %v", netns, err)
 	}
 	defer func() {
 		_ = netns.Close()
 	}()
 
-	bondInterface, err := createBond(args.IfName, bondConf, args.Netns, netns)
+	// a retried ADD finds the bond created by the previous attempt for the same attachment
+	state, err := util.LoadAttachmentState(bondConf.DataDir, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.Netns == args.Netns && state.Result != nil {
+		// the links were moved to the container by the previous attempt
+		if err = resolveLinkSelectors(bondConf, netns); err != nil {
+			return err
+		}
+		if bondConf.ArpTargetsFromIPAM {
+			if err = addArpTargetsFromRecordedResult(args, bondConf, state); err != nil {
+				return err
+			}
+		}
+		reconciledState, err := reconcileExistingBond(args, bondConf, state, netns, tx)
+		if err != nil {
+			return fmt.Errorf("failed to reconcile existing bond (%+v), error: %+v", args.IfName, err)
+		}
+		if reconciledState != nil {
+			if err = util.SaveAttachmentState(bondConf.DataDir, reconciledState); err != nil {
+				return err
+			}
+			prevResult, err := current.NewResult(reconciledState.Result)
+			if err != nil {
+				return fmt.Errorf("failed to parse the result recorded on ADD, error: %+v", err)
+			}
+			return types.PrintResult(prevResult, cniVersion)
+		}
+	}
+
+	if err = ensureBondingModule(bondConf); err != nil {
+		return err
+	}
+
+	linksNs := netns
+	if !bondConf.LinksContNs {
+		if linksNs, err = ns.GetCurrentNS(); err != nil {
+			return fmt.Errorf("failed to get init netns: %v", err)
+		}
+		defer func() {
+			_ = linksNs.Close()
+		}()
+	}
+	if err = resolveLinkSelectors(bondConf, linksNs); err != nil {
+		return err
+	}
+
+	bondInterface, slaves, err := createBond(args.IfName, bondConf, args.Netns, netns, tx)
 	if err != nil {
 		return err
 	}
@@ -368,52 +1730,271 @@ func cmdAdd(args *skel.CmdArgs) error {
 		Interfaces: []*current.Interface{bondInterface},
 	}
 
+	// when chained, pass through the result of the previous plugins with the bond added to it
+	if bondConf.PrevResult != nil {
+		result, err = current.NewResultFromResult(bondConf.PrevResult)
+		if err != nil {
+			return fmt.Errorf("failed to convert prevResult, error: %+v", err)
+		}
+		result.CNIVersion = cniVersion
+		result.Interfaces = append(result.Interfaces, bondInterface)
+	}
+	bondIndex := len(result.Interfaces) - 1
+
+	// the addresses the previous plugins gave to the links now belong to the bond
+	if slaveIPs := repointSlaveIPs(result, slaves, bondIndex); len(slaveIPs) > 0 {
+		if err = moveIPsToBond(netns, args.IfName, result.Interfaces, slaveIPs, tx); err != nil {
+			return err
+		}
+	}
+
 	// run the IPAM plugin and get back the config to apply
 	if bondConf.IPAM.Type != "" {
-		r, err := ipam.ExecAdd(bondConf.IPAM.Type, args.StdinData)
+		ipamResult, err := execIPAMAdd(bondConf.IPAM.Type, args.StdinData, tx)
+		if err != nil {
+			return err
+		}
+		for _, ipc := range ipamResult.IPs {
+			// All addresses belong to the bond interface
+			ipc.Interface = current.Int(bondIndex)
+		}
+
+		// configure only the IPAM addresses, prevResult may hold addresses of other interfaces
+		bondResult := &current.Result{
+			Interfaces: result.Interfaces,
+			IPs:        ipamResult.IPs,
+			Routes:     ipamResult.Routes,
+		}
+		err = netns.Do(func(_ ns.NetNS) error {
+			return ipam.ConfigureIface(args.IfName, bondResult)
+		})
 		if err != nil {
 			return err
 		}
-		// Convert whatever the IPAM result was into the current Result type
-		ipamResult, err := current.NewResultFromResult(r)
-		if err != nil {
-			return err
+
+		if bondConf.ArpTargetsFromIPAM {
+			if err = addArpTargetsFromResult(bondConf, ipamResult, bondIndex); err != nil {
+				return err
+			}
+			if err = setBondArpIpTargets(args.Netns, args.IfName, bondConf); err != nil {
+				return err
+			}
+		}
+
+		result.IPs = append(result.IPs, ipamResult.IPs...)
+		result.Routes = append(result.Routes, ipamResult.Routes...)
+
+		if bondConf.PrevResult == nil || !bondConf.DNS.IsEmpty() {
+			result.DNS = bondConf.DNS
+		}
+	}
+
+	// record the result in the current format, whatever the configuration version, so it can be reused by a retried ADD
+	recordedResult := *result
+	recordedResult.CNIVersion = current.ImplementedSpecVersion
+	resultBytes, err := json.Marshal(&recordedResult)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result, error: %+v", err)
+	}
+
+	// the names the link entries were resolved to, DEL and CHECK cannot select the links again once bonded
+	linkNames, err := getLinkNamesFromConfig(bondConf)
+	if err != nil {
+		return err
+	}
+	err = util.SaveAttachmentState(bondConf.DataDir, &util.AttachmentState{
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		Netns:       args.Netns,
+		Links:       linkNames,
+		Slaves:      slaves,
+		Config:      args.StdinData,
+		Result:      resultBytes,
+	})
+	if err != nil {
+		return err
+	}
+	tx.record(func() error {
+		return util.DeleteAttachmentState(bondConf.DataDir, args.ContainerID, args.IfName)
+	})
+
+	return types.PrintResult(result, cniVersion)
+}
+
+// run ADD on the IPAM plugin and record its DEL in tx as soon as the plugin succeeds, so the addresses are
+// released whatever fails next, even the conversion of the result. return the ipamResult & error
+func execIPAMAdd(ipamType string, stdinData []byte, tx *addTransaction) (*current.Result, error) {
+	r, err := ipam.ExecAdd(ipamType, stdinData)
+	if err != nil {
+		return nil, err
+	}
+	tx.record(func() error {
+		return ipam.ExecDel(ipamType, stdinData)
+	})
+
+	// Convert whatever the IPAM result was into the current Result type
+	ipamResult, err := current.NewResultFromResult(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(ipamResult.IPs) == 0 {
+		return nil, errors.New("IPAM plugin returned missing IP config")
+	}
+	return ipamResult, nil
+}
+
+// point the addresses the previous plugins gave to links now enslaved to the bond at the bond interface of the
+// result. return the re-pointed addresses by the name of the slave holding them
+func repointSlaveIPs(result *current.Result, slaves []util.SlaveState, bondIndex int) map[string][]*current.IPConfig {
+	slaveNames := map[string]bool{}
+	for _, slave := range slaves {
+		slaveNames[slave.Name] = true
+	}
+
+	slaveIPs := map[string][]*current.IPConfig{}
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil || *ipc.Interface < 0 || *ipc.Interface >= len(result.Interfaces) {
+			continue
+		}
+		intf := result.Interfaces[*ipc.Interface]
+		if intf.Sandbox == "" || !slaveNames[intf.Name] {
+			continue
 		}
+		slaveIPs[intf.Name] = append(slaveIPs[intf.Name], ipc)
+		ipc.Interface = current.Int(bondIndex)
+	}
+	return slaveIPs
+}
 
-		if len(ipamResult.IPs) == 0 {
-			return errors.New("IPAM plugin returned missing IP config")
+// move the slaveIPs from the slaves to the bond in netNs, the kernel may already have flushed the IPv6 addresses
+// of the enslaved links. the addresses removed are given back to the slaves on rollback. return error
+func moveIPsToBond(netNs ns.NetNS, bondName string, interfaces []*current.Interface, slaveIPs map[string][]*current.IPConfig, tx *addTransaction) error {
+	return netNs.Do(func(_ ns.NetNS) error {
+		bondIPs := []*current.IPConfig{}
+		for _, slaveName := range slices.Sorted(maps.Keys(slaveIPs)) {
+			slave, err := netlinksafe.LinkByName(slaveName)
+			if err != nil {
+				return fmt.Errorf("failed to find link (%+v), error: %+v", slaveName, err)
+			}
+			removedIPs := []*current.IPConfig{}
+			for _, ipc := range slaveIPs[slaveName] {
+				err = netlink.AddrDel(slave, &netlink.Addr{IPNet: &ipc.Address})
+				if err == nil {
+					removedIPs = append(removedIPs, ipc)
+				} else if !errors.Is(err, unix.EADDRNOTAVAIL) {
+					return fmt.Errorf("failed to remove address (%+v) from link (%+v), error: %+v", ipc.Address.String(), slaveName, err)
+				}
+			}
+			if len(removedIPs) > 0 {
+				tx.record(func() error {
+					return netNs.Do(func(_ ns.NetNS) error {
+						return restoreSlaveIPs(slaveName, removedIPs)
+					})
+				})
+			}
+			bondIPs = append(bondIPs, slaveIPs[slaveName]...)
 		}
-		for _, ipc := range ipamResult.IPs {
-			// All addresses belong to the vlan interface
-			ipc.Interface = current.Int(0)
+
+		return ipam.ConfigureIface(bondName, &current.Result{Interfaces: interfaces, IPs: bondIPs})
+	})
+}
+
+// give the addresses removed by moveIPsToBond back to the slave slaveName. must be called in the container
+// network namespace. return error
+func restoreSlaveIPs(slaveName string, slaveIPs []*current.IPConfig) error {
+	slave, err := netlinksafe.LinkByName(slaveName)
+	if err != nil {
+		return fmt.Errorf("failed to find link (%+v), error: %+v", slaveName, err)
+	}
+	for _, ipc := range slaveIPs {
+		err = netlink.AddrAdd(slave, &netlink.Addr{IPNet: &ipc.Address})
+		if err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to restore address (%+v) of link (%+v), error: %+v", ipc.Address.String(), slaveName, err)
 		}
+	}
+	return nil
+}
 
-		result.IPs = ipamResult.IPs
-		result.Routes = ipamResult.Routes
+// load the configuration applied on ADD from the attachment state, falling back to the runtime configuration
+// for attachments without a recorded state. return the bondConf, the configuration bytes, the state & error
+func loadAttachmentConfig(args *skel.CmdArgs) (*bondingConfig, []byte, *util.AttachmentState, error) {
+	bondConf, _, err := loadConfigFile(args.StdinData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return attachmentConfig(args, bondConf)
+}
 
-		err = netns.Do(func(_ ns.NetNS) error {
-			return ipam.ConfigureIface(args.IfName, result)
-		})
-		if err != nil {
-			return err
+// return the configuration applied on ADD for the runtime configuration bondConf, which is returned itself when
+// no state was recorded. return the bondConf, the configuration bytes, the state & error
+func attachmentConfig(args *skel.CmdArgs, bondConf *bondingConfig) (*bondingConfig, []byte, *util.AttachmentState, error) {
+	state, err := util.LoadAttachmentState(bondConf.DataDir, args.ContainerID, args.IfName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if state == nil {
+		if err = resolveLinksFromPrevResult(bondConf, args.IfName); err != nil {
+			return nil, nil, nil, err
 		}
+		return bondConf, args.StdinData, nil, nil
+	}
 
-		result.DNS = bondConf.DNS
+	addConf, _, err := loadConfigFile(state.Config)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load the configuration recorded on ADD, error: %+v", err)
 	}
+	if err = resolveLinksFromPrevResult(addConf, args.IfName); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to resolve the links recorded on ADD, error: %+v", err)
+	}
+	// keep looking up the state where the runtime configuration says it is
+	addConf.DataDir = bondConf.DataDir
 
-	return types.PrintResult(result, cniVersion)
+	// links selected by attributes keep the name they were resolved to on ADD
+	for i, link := range addConf.Links {
+		if !hasLinkSelector(link) {
+			continue
+		}
+		if i >= len(state.Links) {
+			return nil, nil, nil, fmt.Errorf("link entry (%+v) has no name recorded on ADD, recorded links: %+v", link, state.Links)
+		}
+		link["name"] = state.Links[i]
+	}
+	return addConf, state.Config, state, nil
 }
 
-func cmdDel(args *skel.CmdArgs) error {
-	var err error
+// run DEL on the IPAM plugin with the attachment of args, passed explicitly rather than read from the
+// environment, which GC does not set for the attachments it collects. return error
+func execIPAMDel(args *skel.CmdArgs, ipamType string, stdinData []byte) error {
+	cniPath := os.Getenv("CNI_PATH")
+	pluginPath, err := invoke.FindInPath(ipamType, filepath.SplitList(cniPath))
+	if err != nil {
+		return err
+	}
+	return invoke.ExecPluginWithoutResult(context.TODO(), pluginPath, stdinData, &invoke.Args{
+		Command:       "DEL",
+		ContainerID:   args.ContainerID,
+		NetNS:         args.Netns,
+		PluginArgsStr: args.Args,
+		IfName:        args.IfName,
+		Path:          cniPath,
+	}, nil)
+}
 
-	bondConf, _, err := loadConfigFile(args.StdinData)
+func cmdDel(args *skel.CmdArgs) (retErr error) {
+	bondConf, stdinData, state, err := loadAttachmentConfig(args)
 	if err != nil {
 		return err
 	}
 
+	// forget the attachment only once it has been torn down, a failed DEL is retried by the runtime
+	defer func() {
+		if retErr == nil {
+			retErr = util.DeleteAttachmentState(bondConf.DataDir, args.ContainerID, args.IfName)
+		}
+	}()
+
 	if bondConf.IPAM.Type != "" {
-		err = ipam.ExecDel(bondConf.IPAM.Type, args.StdinData)
+		err = execIPAMDel(args, bondConf.IPAM.Type, stdinData)
 		if err != nil {
 			return err
 		}
@@ -447,6 +2028,18 @@ func cmdDel(args *skel.CmdArgs) error {
 		return fmt.Errorf("failed to find bonded link (%+v), error: %+v", bondConf.Name, err)
 	}
 
+	if state == nil {
+		podNs, err := ns.GetNS(args.Netns)
+		if err != nil {
+			return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+		}
+		err = resolveLinkSelectors(bondConf, podNs)
+		_ = podNs.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	linkObjectsToDeattach, err := getLinkObjectsFromConfig(bondConf, &netNsHandle, true)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve link objects from configuration file (%+v), error: %+v", bondConf, err)
@@ -461,6 +2054,13 @@ func cmdDel(args *skel.CmdArgs) error {
 		return fmt.Errorf("failed to deattached links from bond, error: %+v", err)
 	}
 
+	// links returned to the host are set down while moving, their admin state is restored once they are back
+	if state != nil {
+		if err = restoreSlaves(state.Slaves, &netNsHandle, bondConf.LinksContNs); err != nil {
+			return fmt.Errorf("failed to restore deattached links, error: %+v", err)
+		}
+	}
+
 	// Fetch slave links again to have the latest state
 	// For instance, Active-backup mode with fail_over_mac=0 reverts the mac address of backup slaves
 	for i := range linkObjectsToDeattach {
@@ -483,15 +2083,408 @@ func cmdDel(args *skel.CmdArgs) error {
 		if err := setLinksInNetNs(bondConf, args.Netns, true); err != nil {
 			return fmt.Errorf("failed set links (%+v) in host network namespace, error: %+v", bondConf.Links, err)
 		}
+
+		if state != nil {
+			hostHandle, err := netlinksafe.NewHandle()
+			if err != nil {
+				return fmt.Errorf("failed to create a new handle, error: %+v", err)
+			}
+			defer hostHandle.Close()
+
+			if err = restoreSlaves(state.Slaves, &hostHandle, true); err != nil {
+				return fmt.Errorf("failed to restore links returned to host network namespace, error: %+v", err)
+			}
+		}
 	}
 
 	return err
 }
 
+// plugin specific error codes returned by CHECK and ADD, CNI reserves codes below 100 for the spec
+const (
+	errBondNotFound uint = 100 + iota
+	errBondConfigMismatch
+	errSlaveNotAttached
+	errIPConfigMismatch
+	errBondingModuleUnavailable
+)
+
 func cmdCheck(args *skel.CmdArgs) error {
+	bondConf, _, err := loadConfigFile(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if bondConf.IPAM.Type != "" {
+		err = ipam.ExecCheck(bondConf.IPAM.Type, args.StdinData)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the bond is validated against what ADD applied, prevResult comes from the runtime configuration
+	addConf, _, state, err := attachmentConfig(args, bondConf)
+	if err != nil {
+		return err
+	}
+
+	if bondConf.PrevResult == nil {
+		return types.NewError(types.ErrInvalidNetworkConfig, "required prevResult missing", "")
+	}
+
+	result, err := current.NewResultFromResult(bondConf.PrevResult)
+	if err != nil {
+		return types.NewError(types.ErrDecodingFailure, "failed to convert prevResult", err.Error())
+	}
+
+	bondIndex := -1
+	for i, intf := range result.Interfaces {
+		if intf.Name == args.IfName && intf.Sandbox == args.Netns {
+			bondIndex = i
+			break
+		}
+	}
+	if bondIndex < 0 {
+		return types.NewError(types.ErrInvalidNetworkConfig,
+			fmt.Sprintf("bond (%+v) in netns (%+v) not found in prevResult", args.IfName, args.Netns), "")
+	}
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return types.NewError(types.ErrInvalidNetNS, fmt.Sprintf("failed to open netns %q", args.Netns), err.Error())
+	}
+	defer func() {
+		_ = netns.Close()
+	}()
+
+	if state == nil {
+		if err = resolveLinkSelectors(addConf, netns); err != nil {
+			return types.NewError(errSlaveNotAttached, "failed to resolve links by selector", err.Error())
+		}
+	}
+
+	return netns.Do(func(ns.NetNS) error {
+		netNsHandle, err := netlinksafe.NewHandle()
+		if err != nil {
+			return fmt.Errorf("failed to create a new handle at netNs (%+v), error: %+v", args.Netns, err)
+		}
+		defer netNsHandle.Close()
+
+		link, err := netNsHandle.LinkByName(args.IfName)
+		if err != nil {
+			return types.NewError(errBondNotFound, fmt.Sprintf("failed to find bonded link (%+v)", args.IfName), err.Error())
+		}
+		bondLinkObj, ok := link.(*netlink.Bond)
+		if !ok {
+			return types.NewError(errBondNotFound, fmt.Sprintf("link (%+v) is not a bond, actual type: %+v", args.IfName, link.Type()), "")
+		}
+
+		if err = validateBondConf(bondLinkObj, addConf); err != nil {
+			return types.NewError(errBondConfigMismatch, fmt.Sprintf("bond (%+v) does not match the configuration", args.IfName), err.Error())
+		}
+
+		linkObjectsToBond, err := getLinkObjectsFromConfig(addConf, &netNsHandle, false)
+		if err != nil {
+			return types.NewError(errSlaveNotAttached, "failed to retrieve link objects from configuration file", err.Error())
+		}
+		for _, linkObject := range linkObjectsToBond {
+			if linkObject.Attrs().MasterIndex != bondLinkObj.Index {
+				return types.NewError(errSlaveNotAttached,
+					fmt.Sprintf("link (%+v) is not attached to bond (%+v)", linkObject.Attrs().Name, args.IfName), "")
+			}
+		}
+
+		// the active slave is only the initial one, it changes on failover
+		if addConf.Primary != nil {
+			// a configuration without recorded state was never validated by ADD
+			if *addConf.Primary < 0 || *addConf.Primary >= len(linkObjectsToBond) {
+				return types.NewError(errBondConfigMismatch,
+					fmt.Sprintf("primary (%+v) of bond (%+v) is not the index of a link entry", *addConf.Primary, args.IfName), "")
+			}
+			if bondLinkObj.Primary != linkObjectsToBond[*addConf.Primary].Attrs().Index {
+				return types.NewError(errBondConfigMismatch,
+					fmt.Sprintf("link (%+v) is not the primary of bond (%+v)", linkObjectsToBond[*addConf.Primary].Attrs().Name, args.IfName), "")
+			}
+		}
+
+		// when chained, prevResult also holds the addresses of other interfaces
+		bondIPs := []*current.IPConfig{}
+		for _, ipc := range result.IPs {
+			if ipc.Interface == nil || *ipc.Interface == bondIndex {
+				bondIPs = append(bondIPs, ipc)
+			}
+		}
+		if err = ip.ValidateExpectedInterfaceIPs(args.IfName, bondIPs); err != nil {
+			return types.NewError(errIPConfigMismatch, fmt.Sprintf("bond (%+v) addresses do not match prevResult", args.IfName), err.Error())
+		}
+
+		if err = ip.ValidateExpectedRoute(result.Routes); err != nil {
+			return types.NewError(errIPConfigMismatch, "routes do not match prevResult", err.Error())
+		}
+
+		return nil
+	})
+}
+
+// compare the bond attributes read back from the kernel against the bondConf. return error on the first mismatch
+func validateBondConf(bondLinkObj *netlink.Bond, bondConf *bondingConfig) error {
+	if bondLinkObj.Mode != netlink.StringToBondMode(bondConf.Mode) {
+		return fmt.Errorf("mode mismatch, expected: %+v, actual: %+v", bondConf.Mode, bondLinkObj.Mode)
+	}
+
+	miimon, err := getMiimon(bondConf)
+	if err != nil {
+		return err
+	}
+	if bondLinkObj.Miimon != miimon {
+		return fmt.Errorf("miimon mismatch, expected: %+v, actual: %+v", miimon, bondLinkObj.Miimon)
+	}
+
+	if bondConf.MTU != 0 && bondLinkObj.MTU != bondConf.MTU {
+		return fmt.Errorf("mtu mismatch, expected: %+v, actual: %+v", bondConf.MTU, bondLinkObj.MTU)
+	}
+
+	if bondLinkObj.FailOverMac != netlink.BondFailOverMac(bondConf.FailOverMac) {
+		return fmt.Errorf("failOverMac mismatch, expected: %+v, actual: %+v", bondConf.FailOverMac, int(bondLinkObj.FailOverMac))
+	}
+
+	if bondConf.AllSlavesActive != nil && bondLinkObj.AllSlavesActive != *bondConf.AllSlavesActive {
+		return fmt.Errorf("allSlavesActive mismatch, expected: %+v, actual: %+v", *bondConf.AllSlavesActive, bondLinkObj.AllSlavesActive)
+	}
+
+	if bondConf.TlbDynamicLb != nil && bondLinkObj.TlbDynamicLb != *bondConf.TlbDynamicLb {
+		return fmt.Errorf("tlbDynamicLb mismatch, expected: %+v, actual: %+v", *bondConf.TlbDynamicLb, bondLinkObj.TlbDynamicLb)
+	}
+
+	if bondConf.XmitHashPolicy != nil && bondLinkObj.XmitHashPolicy != netlink.StringToBondXmitHashPolicy(*bondConf.XmitHashPolicy) {
+		return fmt.Errorf("xmitHashPolicy mismatch, expected: %+v, actual: %+v", *bondConf.XmitHashPolicy, bondLinkObj.XmitHashPolicy)
+	}
+
+	if bondConf.ArpInterval != nil && bondLinkObj.ArpInterval != *bondConf.ArpInterval {
+		return fmt.Errorf("arpInterval mismatch, expected: %+v, actual: %+v", *bondConf.ArpInterval, bondLinkObj.ArpInterval)
+	}
+
+	if len(bondConf.ArpIpTargets) > 0 {
+		actualTargets := []string{}
+		for _, target := range bondLinkObj.ArpIpTargets {
+			actualTargets = append(actualTargets, target.String())
+		}
+		for _, target := range bondConf.ArpIpTargets {
+			if !slices.Contains(actualTargets, net.ParseIP(target).String()) {
+				return fmt.Errorf("arpIpTargets mismatch, expected: %+v, actual: %+v", bondConf.ArpIpTargets, actualTargets)
+			}
+		}
+	}
+
+	if bondConf.ArpValidate != nil && bondLinkObj.ArpValidate != arpValidateValues[*bondConf.ArpValidate] {
+		return fmt.Errorf("arpValidate mismatch, expected: %+v, actual: %+v", *bondConf.ArpValidate, int(bondLinkObj.ArpValidate))
+	}
+
+	if bondConf.ArpAllTargets != nil && bondLinkObj.ArpAllTargets != netlink.StringToBondArpAllTargetsMap[*bondConf.ArpAllTargets] {
+		return fmt.Errorf("arpAllTargets mismatch, expected: %+v, actual: %+v", *bondConf.ArpAllTargets, bondLinkObj.ArpAllTargets)
+	}
+
+	if bondConf.UpDelay != nil && bondLinkObj.UpDelay != *bondConf.UpDelay {
+		return fmt.Errorf("updelay mismatch, expected: %+v, actual: %+v", *bondConf.UpDelay, bondLinkObj.UpDelay)
+	}
+
+	if bondConf.DownDelay != nil && bondLinkObj.DownDelay != *bondConf.DownDelay {
+		return fmt.Errorf("downdelay mismatch, expected: %+v, actual: %+v", *bondConf.DownDelay, bondLinkObj.DownDelay)
+	}
+
+	if bondConf.PrimaryReselect != nil && bondLinkObj.PrimaryReselect != netlink.StringToBondPrimaryReselectMap[*bondConf.PrimaryReselect] {
+		return fmt.Errorf("primaryReselect mismatch, expected: %+v, actual: %+v", *bondConf.PrimaryReselect, bondLinkObj.PrimaryReselect)
+	}
+
+	if numPeerNotif := getNumPeerNotif(bondConf); numPeerNotif != nil && bondLinkObj.NumPeerNotif != *numPeerNotif {
+		return fmt.Errorf("numGratArp mismatch, expected: %+v, actual: %+v", *numPeerNotif, bondLinkObj.NumPeerNotif)
+	}
+
+	if bondConf.ResendIgmp != nil && bondLinkObj.ResendIgmp != *bondConf.ResendIgmp {
+		return fmt.Errorf("resendIgmp mismatch, expected: %+v, actual: %+v", *bondConf.ResendIgmp, bondLinkObj.ResendIgmp)
+	}
+
+	if bondConf.PacketsPerSlave != nil && bondLinkObj.PacketsPerSlave != *bondConf.PacketsPerSlave {
+		return fmt.Errorf("packetsPerSlave mismatch, expected: %+v, actual: %+v", *bondConf.PacketsPerSlave, bondLinkObj.PacketsPerSlave)
+	}
+
+	if bondConf.LpInterval != nil && bondLinkObj.LpInterval != *bondConf.LpInterval {
+		return fmt.Errorf("lpInterval mismatch, expected: %+v, actual: %+v", *bondConf.LpInterval, bondLinkObj.LpInterval)
+	}
+
+	if bondConf.MinLinks != nil && bondLinkObj.MinLinks != *bondConf.MinLinks {
+		return fmt.Errorf("minLinks mismatch, expected: %+v, actual: %+v", *bondConf.MinLinks, bondLinkObj.MinLinks)
+	}
+
+	if bondConf.LacpRate != nil && bondLinkObj.LacpRate != netlink.StringToBondLacpRate(*bondConf.LacpRate) {
+		return fmt.Errorf("lacpRate mismatch, expected: %+v, actual: %+v", *bondConf.LacpRate, bondLinkObj.LacpRate)
+	}
+
+	if bondConf.AdSelect != nil && bondLinkObj.AdSelect != netlink.StringToBondAdSelectMap[*bondConf.AdSelect] {
+		return fmt.Errorf("adSelect mismatch, expected: %+v, actual: %+v", *bondConf.AdSelect, bondLinkObj.AdSelect)
+	}
+
+	if bondConf.AdActorSysPrio != nil && bondLinkObj.AdActorSysPrio != *bondConf.AdActorSysPrio {
+		return fmt.Errorf("adActorSysPrio mismatch, expected: %+v, actual: %+v", *bondConf.AdActorSysPrio, bondLinkObj.AdActorSysPrio)
+	}
+
+	if bondConf.AdUserPortKey != nil && bondLinkObj.AdUserPortKey != *bondConf.AdUserPortKey {
+		return fmt.Errorf("adUserPortKey mismatch, expected: %+v, actual: %+v", *bondConf.AdUserPortKey, bondLinkObj.AdUserPortKey)
+	}
+
+	if bondConf.AdActorSystem != nil {
+		adActorSystem, _ := net.ParseMAC(*bondConf.AdActorSystem)
+		if !bytes.Equal(bondLinkObj.AdActorSystem, adActorSystem) {
+			return fmt.Errorf("adActorSystem mismatch, expected: %+v, actual: %+v", *bondConf.AdActorSystem, bondLinkObj.AdActorSystem)
+		}
+	}
+
+	return nil
+}
+
+func cmdGC(args *skel.CmdArgs) error {
+	bondConf, _, err := loadConfigFile(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	validAttachments := map[types.GCAttachment]bool{}
+	for _, attachment := range bondConf.ValidAttachments {
+		validAttachments[attachment] = true
+	}
+
+	// unreadable states are reported, the others are still collected
+	var gcErrs []error
+	states, err := util.ListAttachmentStates(bondConf.DataDir)
+	if err != nil {
+		gcErrs = append(gcErrs, err)
+	}
+
+	for _, state := range states {
+		attachment := types.GCAttachment{ContainerID: state.ContainerID, IfName: state.IfName}
+		if validAttachments[attachment] {
+			continue
+		}
+
+		// the data directory may be shared with other bond networks, only collect our own attachments
+		addConf, _, err := loadConfigFile(state.Config)
+		if err != nil {
+			// the network name is enough to tell another network apart, an attachment of ours is reported rather than leaked
+			netConf := &types.NetConf{}
+			if jsonErr := json.Unmarshal(state.Config, netConf); jsonErr == nil && netConf.Name != bondConf.Name {
+				continue
+			}
+			gcErrs = append(gcErrs, fmt.Errorf("failed to load the configuration recorded for attachment (%+v/%+v), error: %+v", state.ContainerID, state.IfName, err))
+			continue
+		}
+		if addConf.Name != bondConf.Name {
+			continue
+		}
+
+		if err = gcAttachment(state, bondConf.DataDir); err != nil {
+			gcErrs = append(gcErrs, fmt.Errorf("failed to collect attachment (%+v/%+v), error: %+v", state.ContainerID, state.IfName, err))
+		}
+	}
+
+	// the IPAM plugin releases the addresses of any attachment missing from the valid attachments, including
+	// those without a recorded state
+	if bondConf.IPAM.Type != "" {
+		if err = invoke.DelegateGC(context.TODO(), bondConf.IPAM.Type, args.StdinData, nil); err != nil {
+			gcErrs = append(gcErrs, fmt.Errorf("failed to run GC on IPAM plugin (%+v), error: %+v", bondConf.IPAM.Type, err))
+		}
+	}
+	return errors.Join(gcErrs...)
+}
+
+// tear down a stale attachment the same way DEL would, the attachment being passed to the IPAM plugin explicitly
+func gcAttachment(state *util.AttachmentState, dataDir string) error {
+	// when the pod netns is gone the kernel already destroyed the bond and returned physical links to the host
+	netnsPath := state.Netns
+	podNs, err := ns.GetNS(netnsPath)
+	if err != nil {
+		netnsPath = ""
+	} else {
+		_ = podNs.Close()
+	}
+
+	err = cmdDel(&skel.CmdArgs{
+		ContainerID: state.ContainerID,
+		Netns:       netnsPath,
+		IfName:      state.IfName,
+		StdinData:   state.Config,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the configuration recorded on ADD may point at another data directory than the one GC was asked about
+	return util.DeleteAttachmentState(dataDir, state.ContainerID, state.IfName)
+}
+
+// error code defined by the CNI spec for STATUS, the plugin cannot service ADD requests
+const errPluginNotAvailable uint = 50
+
+func cmdStatus(args *skel.CmdArgs) error {
+	bondConf, _, err := loadConfigFile(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	available, err := util.IsBondingModuleAvailable()
+	if err != nil {
+		return types.NewError(errPluginNotAvailable, "failed to detect the bonding kernel module", err.Error())
+	}
+	if !available {
+		return types.NewError(errPluginNotAvailable, "bonding kernel module is not available", "")
+	}
+
+	// the IPAM plugin reports itself whether it can allocate addresses, its error code is passed through
+	if bondConf.IPAM.Type != "" {
+		if err = ipam.ExecStatus(bondConf.IPAM.Type, args.StdinData); err != nil {
+			var cniErr *types.Error
+			if errors.As(err, &cniErr) {
+				return cniErr
+			}
+			return types.NewError(errPluginNotAvailable, fmt.Sprintf("IPAM plugin (%+v) is not available", bondConf.IPAM.Type), err.Error())
+		}
+	}
+
+	// chained links are only known from prevResult at ADD
+	if bondConf.LinksContNs || linksFromPrevResult(bondConf) {
+		return nil
+	}
+
+	hostNs, err := ns.GetCurrentNS()
+	if err != nil {
+		return fmt.Errorf("failed to get init netns: %v", err)
+	}
+	defer func() {
+		_ = hostNs.Close()
+	}()
+	if err = resolveLinkSelectors(bondConf, hostNs); err != nil {
+		return types.NewError(errPluginNotAvailable, "links are not available in host network namespace", err.Error())
+	}
+
+	hostHandle, err := netlinksafe.NewHandle()
+	if err != nil {
+		return fmt.Errorf("failed to create a new handle, error: %+v", err)
+	}
+	defer hostHandle.Close()
+
+	linkObjects, err := getLinkObjectsFromConfig(bondConf, &hostHandle, false)
+	if err != nil {
+		return types.NewError(errPluginNotAvailable, "links are not available in host network namespace", err.Error())
+	}
+	for _, linkObject := range linkObjects {
+		if linkObject.Attrs().MasterIndex != 0 {
+			return types.NewError(errPluginNotAvailable,
+				fmt.Sprintf("link (%+v) is already enslaved, master index: %+v", linkObject.Attrs().Name, linkObject.Attrs().MasterIndex), "")
+		}
+	}
+
 	return nil
 }
 
 func main() {
-	skel.PluginMainFuncs(skel.CNIFuncs{Add: cmdAdd, Del: cmdDel, Check: cmdCheck}, version.All, "")
+	skel.PluginMainFuncs(skel.CNIFuncs{Add: cmdAdd, Del: cmdDel, Check: cmdCheck, GC: cmdGC, Status: cmdStatus}, version.All, "")
 }
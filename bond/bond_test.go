@@ -15,7 +15,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/containernetworking/cni/pkg/skel"
@@ -30,6 +35,9 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/intel/bond-cni/bond/util"
 )
 
 const (
@@ -48,6 +56,10 @@ var _ = Describe("bond plugin", func() {
 	var initNS ns.NetNS
 	var args *skel.CmdArgs
 	var linksInContainer bool
+	var dataDir string
+	BeforeEach(func() {
+		dataDir = GinkgoT().TempDir()
+	})
 	AfterEach(func() {
 		Expect(podNS.Close()).To(Succeed())
 		Expect(testutils.UnmountNS(podNS)).To(Succeed())
@@ -86,7 +98,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, "1.0.0", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "1.0.0", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir),
 			}
 		})
 
@@ -127,6 +139,298 @@ var _ = Describe("bond plugin", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("verifies the check command detects a slave released from the bond", func() {
+			By("creating the plugin")
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			checkArgs := *args
+			checkArgs.StdinData = buildPrevResultConfig(args.StdinData, r)
+
+			By("checking the bond matches the configuration")
+			err = testutils.CmdCheckWithArgs(&checkArgs, func() error {
+				return cmdCheck(&checkArgs)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+
+				By("releasing a slave from the bond")
+				slave, err := netlinksafe.LinkByName(Slave2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.LinkSetNoMaster(slave)).To(Succeed())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("checking the bond does not match the configuration anymore")
+			err = testutils.CmdCheckWithArgs(&checkArgs, func() error {
+				return cmdCheck(&checkArgs)
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*types.Error).Code).To(Equal(errSlaveNotAttached))
+
+			By("deleting the plugin")
+			err = testutils.CmdDel(podNS.Path(),
+				args.ContainerID, "", func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the bond is rolled back when IPAM fails", func() {
+			args.StdinData = []byte(`{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"failOverMac": 1,
+			"linksInContainer": true,
+			"miimon": "100",
+			"links": [
+				{"name": "net1"},
+				{"name": "net2"}
+			],
+			"ipam": {"type": "non-existing-ipam"}
+		}`)
+			args.StdinData = withDataDir(args.StdinData, dataDir)
+
+			By("creating the plugin")
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).To(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the bond interface was removed")
+				_, err := netlinksafe.LinkByName(IfName)
+				Expect(err).To(HaveOccurred())
+
+				By("validating the slaves were released")
+				for _, slaveName := range Slaves {
+					slave, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(slave.Attrs().MasterIndex).To(Equal(0))
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the slaves mtu and admin state are restored on delete", func() {
+			var originalMTU int
+
+			err := podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("storing the mtu of the slaves")
+				slave, err := netlinksafe.LinkByName(Slave1)
+				Expect(err).NotTo(HaveOccurred())
+				originalMTU = slave.Attrs().MTU
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(originalMTU).NotTo(Equal(DefaultMTU))
+
+			By("creating the plugin")
+			_, _, err = testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("deleting the plugin")
+			err = testutils.CmdDel(podNS.Path(),
+				args.ContainerID, "", func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the slaves are back to their original mtu and admin state")
+				for _, slaveName := range Slaves {
+					slave, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(slave.Attrs().MTU).To(Equal(originalMTU))
+					Expect(slave.Attrs().Flags & net.FlagUp).To(BeZero())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the gc command only collects stale attachments", func() {
+			By("creating the plugin")
+			_, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("collecting garbage while the attachment is still valid")
+			gcArgs := &skel.CmdArgs{
+				StdinData: buildGCConfig(args.StdinData, []types.GCAttachment{{ContainerID: args.ContainerID, IfName: args.IfName}}),
+			}
+			Expect(cmdGC(gcArgs)).To(Succeed())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the bond interface still exists")
+				_, err := netlinksafe.LinkByName(IfName)
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("collecting garbage once the attachment is not valid anymore")
+			gcArgs.StdinData = buildGCConfig(args.StdinData, []types.GCAttachment{})
+			Expect(cmdGC(gcArgs)).To(Succeed())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the bond interface was removed")
+				_, err := netlinksafe.LinkByName(IfName)
+				Expect(err).To(HaveOccurred())
+
+				By("validating the slaves were released")
+				for _, slaveName := range Slaves {
+					slave, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(slave.Attrs().MasterIndex).To(Equal(0))
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("validating the attachment state was removed")
+			state, err := util.LoadAttachmentState(dataDir, args.ContainerID, args.IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(BeNil())
+		})
+
+		It("verifies a retried add reconciles the existing bond and returns the same result", func() {
+			By("creating the plugin")
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("releasing a slave from the bond")
+				slave, err := netlinksafe.LinkByName(Slave2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(netlink.LinkSetNoMaster(slave)).To(Succeed())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("retrying the add")
+			retryResult, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retryResult).To(Equal(r))
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the bond slaves are configured correctly")
+				link, err := netlinksafe.LinkByName(IfName)
+				Expect(err).NotTo(HaveOccurred())
+				validateBondIFConf(link, DefaultMTU, ActiveBackupMode, 100)
+				validateBondSlavesConf(link, Slaves)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("deleting the plugin")
+			err = testutils.CmdDel(podNS.Path(),
+				args.ContainerID, "", func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the plugin bonds the interfaces of prevResult when chained", func() {
+			By("building a configuration chained after the plugins which created the slaves")
+			prevResult := &types100.Result{
+				CNIVersion: "1.0.0",
+				Interfaces: []*types100.Interface{
+					{Name: Slave1, Sandbox: podNS.Path()},
+					{Name: Slave2, Sandbox: podNS.Path()},
+				},
+			}
+			args.StdinData = buildPrevResultConfig([]byte(`{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"failOverMac": 1,
+			"miimon": "100",
+			"mtu": 1400
+		}`), prevResult)
+			args.StdinData = withDataDir(args.StdinData, dataDir)
+
+			By("creating the plugin")
+			r, _, err := testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("validating the bond was added to the previous result")
+			result, err := types100.GetResult(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Interfaces).To(HaveLen(3))
+			Expect(result.Interfaces[0].Name).To(Equal(Slave1))
+			Expect(result.Interfaces[1].Name).To(Equal(Slave2))
+			Expect(result.Interfaces[2].Name).To(Equal(IfName))
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the bond slaves are configured correctly")
+				link, err := netlinksafe.LinkByName(IfName)
+				Expect(err).NotTo(HaveOccurred())
+				validateBondSlavesConf(link, Slaves)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("deleting the plugin")
+			err = testutils.CmdDel(podNS.Path(),
+				args.ContainerID, "", func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the primary slave is set after the links are attached", func() {
+			confMap := map[string]interface{}{}
+			Expect(json.Unmarshal(args.StdinData, &confMap)).To(Succeed())
+			confMap["primary"] = 1
+			confMap["primaryReselect"] = "failure"
+			stdinData, err := json.Marshal(confMap)
+			Expect(err).NotTo(HaveOccurred())
+			args.StdinData = stdinData
+
+			By("creating the plugin")
+			_, _, err = testutils.CmdAddWithArgs(args, func() error {
+				return cmdAdd(args)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("validating the second link is the primary of the bond")
+				link, err := netlinksafe.LinkByName(IfName)
+				Expect(err).NotTo(HaveOccurred())
+				slave, err := netlinksafe.LinkByName(Slave2)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link.(*netlink.Bond).Primary).To(Equal(slave.Attrs().Index))
+				Expect(link.(*netlink.Bond).PrimaryReselect).To(Equal(netlink.BOND_PRIMARY_RESELECT_FAILURE))
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("deleting the plugin")
+			err = testutils.CmdDel(podNS.Path(),
+				args.ContainerID, "", func() error { return cmdDel(args) })
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It("verifies the plugin handles multiple del commands", func() {
 			By("adding a bond interface")
 			_, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -172,7 +476,7 @@ var _ = Describe("bond plugin", func() {
 		})
 
 		DescribeTable("verifies the plugin returns correct results for supported tested versions", func(version string) {
-			args.StdinData = []byte(fmt.Sprintf(config, version, ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU)))
+			args.StdinData = withDataDir([]byte(fmt.Sprintf(config, version, ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir)
 
 			By(fmt.Sprintf("creating the plugin with config in version %s", version))
 			r, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -197,7 +501,7 @@ var _ = Describe("bond plugin", func() {
 		)
 
 		It("verifies the plugin copes with duplicated macs in balance-tlb mode", func() {
-			args.StdinData = []byte(fmt.Sprintf(config, "0.3.1", BalanceTlbMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU)))
+			args.StdinData = withDataDir([]byte(fmt.Sprintf(config, "0.3.1", BalanceTlbMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir)
 
 			err := podNS.Do(func(ns.NetNS) error {
 				defer GinkgoRecover()
@@ -304,7 +608,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, "1.0.0", ActiveBackupMode, 0, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "1.0.0", ActiveBackupMode, 0, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir),
 			}
 
 			r, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -399,7 +703,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), bondMTU)),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), bondMTU)), dataDir),
 			}
 			By("creating the plugin")
 			_, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -448,7 +752,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, ActiveBackupMode, allSlavesActive)),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, ActiveBackupMode, allSlavesActive)), dataDir),
 			}
 			By("creating the plugin")
 			r, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -520,7 +824,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, BalanceTlbMode, xmitHashPolicy)),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, BalanceTlbMode, xmitHashPolicy)), dataDir),
 			}
 			By("creating the plugin")
 			r, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -593,7 +897,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, BalanceTlbMode, tlbDynamicLb)),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, BalanceTlbMode, tlbDynamicLb)), dataDir),
 			}
 			By("creating the plugin")
 			r, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -632,7 +936,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, ActiveBackupMode, 0)),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, ActiveBackupMode, 0)), dataDir),
 			}
 			By("creating the plugin")
 			_, _, err := testutils.CmdAddWithArgs(args, func() error {
@@ -683,7 +987,7 @@ var _ = Describe("bond plugin", func() {
 				ContainerID: "dummy",
 				Netns:       podNS.Path(),
 				IfName:      IfName,
-				StdinData:   []byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))),
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir),
 			}
 			err := initNS.Do(func(ns.NetNS) error {
 				defer GinkgoRecover()
@@ -744,22 +1048,1211 @@ var _ = Describe("bond plugin", func() {
 			})
 			Expect(err).NotTo(HaveOccurred())
 		})
-	})
-})
 
-func addLinksInNS(initNS ns.NetNS, links []netlink.LinkAttrs) {
-	for _, link := range links {
-		var err error
-		err = initNS.Do(func(ns.NetNS) error {
-			defer GinkgoRecover()
-			err = netlink.LinkAdd(&netlink.Dummy{
-				LinkAttrs: link,
+		It("verifies the del command uses the state recorded on add when the configuration changed", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       podNS.Path(),
+				IfName:      IfName,
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir),
+			}
+			err := initNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("creating the plugin")
+				_, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("validating the attachment state was recorded")
+				state, err := util.LoadAttachmentState(dataDir, args.ContainerID, args.IfName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state).NotTo(BeNil())
+				Expect(state.Slaves).To(HaveLen(len(Slaves)))
+
+				By("deleting the plugin with a configuration claiming the links were in the container")
+				args.StdinData = withDataDir([]byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, "true", strconv.Itoa(DefaultMTU))), dataDir)
+				err = testutils.CmdDelWithArgs(args, func() error {
+					return cmdDel(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking that links are back in initial namespace")
+				for _, slaveName := range Slaves {
+					_, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				By("validating the attachment state was removed")
+				state, err = util.LoadAttachmentState(dataDir, args.ContainerID, args.IfName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state).To(BeNil())
+				return nil
 			})
 			Expect(err).NotTo(HaveOccurred())
-			return nil
 		})
-		Expect(err).NotTo(HaveOccurred())
-	}
+
+		It("verifies the status command reports whether the links can be bonded", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       podNS.Path(),
+				IfName:      IfName,
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "1.1.0", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), strconv.Itoa(DefaultMTU))), dataDir),
+			}
+			err := initNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("checking the plugin is available while the links are in initial namespace")
+				Expect(cmdStatus(args)).To(Succeed())
+
+				By("creating the plugin")
+				_, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("checking the plugin is not available once the links are in use")
+				err = cmdStatus(args)
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*types.Error).Code).To(Equal(errPluginNotAvailable))
+
+				By("deleting the plugin")
+				err = testutils.CmdDelWithArgs(args, func() error {
+					return cmdDel(args)
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies the links are returned to the initial namespace when the add fails", func() {
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				Netns:       podNS.Path(),
+				IfName:      IfName,
+				StdinData:   withDataDir([]byte(fmt.Sprintf(config, "0.3.1", ActiveBackupMode, 1, strconv.FormatBool(linksInContainer), "9000")), dataDir),
+			}
+			err := initNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("creating the plugin with a bond MTU bigger than the links MTU")
+				_, _, err := testutils.CmdAddWithArgs(args, func() error {
+					return cmdAdd(args)
+				})
+				Expect(err).To(HaveOccurred())
+
+				By("Checking that links are in initial namespace")
+				for _, slaveName := range Slaves {
+					_, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = podNS.Do(func(ns.NetNS) error {
+				defer GinkgoRecover()
+				By("Checking that neither the bond nor the links are in pod namespace")
+				_, err := netlinksafe.LinkByName(IfName)
+				Expect(err).To(HaveOccurred())
+				for _, slaveName := range Slaves {
+					_, err := netlinksafe.LinkByName(slaveName)
+					Expect(err).To(HaveOccurred())
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("bond configuration", func() {
+	When("options are checked against the mode", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "%s",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		DescribeTable("accepts options supported by the mode", func(mode, options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+		},
+			Entry("when failOverMac is set in active-backup mode", "active-backup", `"failOverMac": 2,`),
+			Entry("when failOverMac is set in balance-tlb mode", "balance-tlb", `"failOverMac": 1,`),
+			Entry("when failOverMac is 0 in 802.3ad mode", "802.3ad", `"failOverMac": 0,`),
+			Entry("when xmitHashPolicy is set in 802.3ad mode", "802.3ad", `"xmitHashPolicy": "layer3+4",`),
+			Entry("when allSlavesActive is set in balance-rr mode", "balance-rr", `"allSlavesActive": 1,`),
+		)
+
+		DescribeTable("rejects options the mode ignores or values out of range", func(mode, options, expectedError string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).To(MatchError(ContainSubstring(expectedError)))
+		},
+			Entry("when failOverMac is set in 802.3ad mode", "802.3ad", `"failOverMac": 1,`,
+				"failOverMac is not supported in 802.3ad mode"),
+			Entry("when xmitHashPolicy is set in active-backup mode", "active-backup", `"xmitHashPolicy": "layer2",`,
+				"xmitHashPolicy is not supported in active-backup mode"),
+			Entry("when tlbDynamicLb is set in active-backup mode", "active-backup", `"tlbDynamicLb": 0,`,
+				"tlbDynamicLb is not supported in active-backup mode"),
+			Entry("when arpInterval is set in balance-tlb mode", "balance-tlb", `"arpInterval": 100, "arpIpTargets": ["192.168.1.1"],`,
+				"arpInterval is not supported in balance-tlb mode"),
+			Entry("when failOverMac is out of range", "active-backup", `"failOverMac": 3,`,
+				"failOverMac should be between 0 and 2"),
+			Entry("when allSlavesActive is out of range", "active-backup", `"allSlavesActive": 2,`,
+				"allSlavesActive should be between 0 and 1"),
+		)
+	})
+
+	When("a recorded configuration is rejected on ADD", func() {
+		// accepted before the options were checked against the mode
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "802.3ad",
+			"miimon": "100",
+			"failOverMac": 1,
+			"dataDir": "%s",
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("is still loaded by the commands tearing down the attachment", func() {
+			dataDir := GinkgoT().TempDir()
+			stdinData := []byte(fmt.Sprintf(config, dataDir))
+			_, _, err := loadAddConfig(stdinData, IfName)
+			Expect(err).To(MatchError(ContainSubstring("failOverMac is not supported in 802.3ad mode")))
+
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{
+				ContainerID: "dummy",
+				IfName:      "bond0",
+				Netns:       "/var/run/netns/pod",
+				Slaves:      []util.SlaveState{{Name: "net1"}, {Name: "net2"}},
+				Config:      stdinData,
+			})).To(Succeed())
+
+			bondConf, _, state, err := loadAttachmentConfig(&skel.CmdArgs{ContainerID: "dummy", IfName: "bond0", StdinData: stdinData})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).NotTo(BeNil())
+			linkNames, err := getLinkNamesFromConfig(bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(linkNames).To(Equal([]string{"net1", "net2"}))
+		})
+	})
+
+	When("the IPAM plugin is run on ADD", func() {
+		It("releases the addresses when the IPAM result is rejected", func() {
+			// a fake IPAM plugin returning no address, which records that it was asked to release
+			cniPath := GinkgoT().TempDir()
+			released := filepath.Join(cniPath, "released")
+			Expect(os.WriteFile(filepath.Join(cniPath, "empty-ipam"), []byte(fmt.Sprintf(
+				"#!/bin/sh\nif [ \"$CNI_COMMAND\" = DEL ]; then touch %s; exit 0; fi\necho '{\"cniVersion\": \"1.0.0\"}'\n", released)), 0700)).To(Succeed())
+			GinkgoT().Setenv("CNI_PATH", cniPath)
+
+			tx := &addTransaction{}
+			_, err := execIPAMAdd("empty-ipam", []byte(`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "ipam": {"type": "empty-ipam"}}`), tx)
+			Expect(err).To(MatchError("IPAM plugin returned missing IP config"))
+			Expect(released).NotTo(BeAnExistingFile())
+
+			Expect(tx.rollback(err)).To(MatchError(err))
+			Expect(released).To(BeAnExistingFile())
+		})
+	})
+
+	When("a retried ADD finds the bond of the previous attempt", func() {
+		It("takes the names of links selected by attributes from the recorded links", func() {
+			dataDir := GinkgoT().TempDir()
+			stdinData := withDataDir([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "active-backup",
+				"miimon": "100",
+				"linksInContainer": true,
+				"links": [{"mac": "02:00:00:00:00:01"}, {"name": "net2"}, {"mac": "02:00:00:00:00:03"}]
+			}`), dataDir)
+			// the slave net1 was released since, the slaves no longer line up with the link entries
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{
+				ContainerID: "dummy",
+				IfName:      IfName,
+				Links:       []string{"net1", "net2", "net3"},
+				Slaves:      []util.SlaveState{{Name: "net2"}, {Name: "net3"}},
+				Config:      stdinData,
+			})).To(Succeed())
+
+			bondConf, _, _, err := loadAttachmentConfig(&skel.CmdArgs{ContainerID: "dummy", IfName: IfName, StdinData: stdinData})
+			Expect(err).NotTo(HaveOccurred())
+			linkNames, err := getLinkNamesFromConfig(bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(linkNames).To(Equal([]string{"net1", "net2", "net3"}))
+		})
+
+		It("resets the options removed from the configuration to their kernel default", func() {
+			prevConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "802.3ad",
+				"miimon": "100",
+				"updelay": 200,
+				"numGratArp": 3,
+				"numUnsolNa": 3,
+				"lacpRate": "fast",
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			bondConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "active-backup",
+				"miimon": "100",
+				"numUnsolNa": 3,
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resetRemovedOptions(bondConf, prevConf)).To(BeTrue())
+			Expect(*bondConf.UpDelay).To(Equal(0))
+			// numGratArp and numUnsolNa set the same kernel option, which is still configured
+			Expect(bondConf.NumGratArp).To(BeNil())
+			// lacpRate does not apply to active-backup
+			Expect(bondConf.LacpRate).To(BeNil())
+			Expect(resetRemovedOptions(bondConf, bondConf)).To(BeFalse())
+		})
+
+		It("keeps the delays when the configuration switches to ARP monitoring", func() {
+			prevConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "active-backup",
+				"miimon": "100",
+				"updelay": 200,
+				"downdelay": 100,
+				"peerNotifDelay": 300,
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			bondConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "active-backup",
+				"arpInterval": 100,
+				"arpIpTargets": ["192.168.1.1"],
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			// the kernel refuses any delay while the MII monitor is disabled
+			Expect(resetRemovedOptions(bondConf, prevConf)).To(BeFalse())
+			Expect(bondConf.UpDelay).To(BeNil())
+			Expect(bondConf.DownDelay).To(BeNil())
+			Expect(bondConf.PeerNotifDelay).To(BeNil())
+		})
+	})
+
+	When("links are taken from prevResult", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			"links": %s,
+			"prevResult": {
+				"cniVersion": "1.0.0",
+				"interfaces": [
+					{"name": "eth0", "sandbox": "/var/run/netns/pod"},
+					{"name": "veth0"},
+					{"name": "net1", "sandbox": "/var/run/netns/pod"},
+					{"name": "net2", "sandbox": "/var/run/netns/pod"}
+				]
+			}
+		}`
+
+		DescribeTable("resolves the links to the container interfaces", func(links string, expectedLinks []string) {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, links)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.LinksContNs).To(BeTrue())
+
+			linkNames, err := getLinkNamesFromConfig(bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(linkNames).To(Equal(expectedLinks))
+		},
+			Entry("when links are omitted", `[]`, []string{"eth0", "net1", "net2"}),
+			Entry("when links reference result indices", `[{"resultIndex": 2}, {"resultIndex": 3}]`, []string{"net1", "net2"}),
+			Entry("when links mix names and result indices", `[{"name": "net1"}, {"resultIndex": 3}]`, []string{"net1", "net2"}),
+		)
+
+		DescribeTable("rejects invalid result indices", func(links string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, links)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the index is out of range", `[{"resultIndex": 2}, {"resultIndex": 4}]`),
+			Entry("when the interface is not in the container", `[{"resultIndex": 1}, {"resultIndex": 2}]`),
+			Entry("when the index is not an integer", `[{"resultIndex": 2}, {"resultIndex": "3"}]`),
+		)
+
+		It("leaves the bond out of the links found in the prevResult of DEL", func() {
+			bondConf, _, err := loadConfigFile([]byte(fmt.Sprintf(config, `[]`)))
+			Expect(err).NotTo(HaveOccurred())
+			prevResult, err := types100.NewResultFromResult(bondConf.PrevResult)
+			Expect(err).NotTo(HaveOccurred())
+			prevResult.Interfaces = append(prevResult.Interfaces, &types100.Interface{Name: IfName, Sandbox: "/var/run/netns/pod"})
+
+			args := &skel.CmdArgs{
+				ContainerID: "dummy",
+				IfName:      IfName,
+				StdinData:   withDataDir(buildPrevResultConfig([]byte(fmt.Sprintf(config, `[]`)), prevResult), GinkgoT().TempDir()),
+			}
+			delConf, _, state, err := loadAttachmentConfig(args)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(BeNil())
+
+			linkNames, err := getLinkNamesFromConfig(delConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(linkNames).To(Equal([]string{"eth0", "net1", "net2"}))
+		})
+
+		It("points the addresses of the enslaved links at the bond", func() {
+			result := &types100.Result{
+				Interfaces: []*types100.Interface{
+					{Name: "eth0", Sandbox: "/var/run/netns/pod"},
+					{Name: "net1", Sandbox: "/var/run/netns/pod"},
+					{Name: "net2", Sandbox: "/var/run/netns/pod"},
+					{Name: IfName, Sandbox: "/var/run/netns/pod"},
+				},
+				IPs: []*types100.IPConfig{
+					{Interface: types100.Int(0), Address: net.IPNet{IP: net.ParseIP("10.0.0.10"), Mask: net.CIDRMask(24, 32)}},
+					{Interface: types100.Int(1), Address: net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}},
+				},
+			}
+			slaveIPs := repointSlaveIPs(result, []util.SlaveState{{Name: "net1"}, {Name: "net2"}}, 3)
+			Expect(slaveIPs).To(HaveKeyWithValue("net1", []*types100.IPConfig{result.IPs[1]}))
+			Expect(*result.IPs[0].Interface).To(Equal(0))
+			Expect(*result.IPs[1].Interface).To(Equal(3))
+		})
+	})
+
+	When("links are selected by PCI address", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			"linksInContainer": true,
+			"links": %s,
+			"runtimeConfig": {"deviceIDs": ["0000:03:02.0", "0000:03:02.1"]}
+		}`
+
+		It("takes the links from runtimeConfig deviceIDs when links are omitted", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, `[]`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.Links).To(Equal([]map[string]interface{}{
+				{"deviceID": "0000:03:02.0"},
+				{"deviceID": "0000:03:02.1"},
+			}))
+		})
+
+		It("keeps the configured links over runtimeConfig deviceIDs", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, `[{"name": "net1"}, {"deviceID": "0000:82:00.1"}]`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.Links).To(Equal([]map[string]interface{}{
+				{"name": "net1"},
+				{"deviceID": "0000:82:00.1"},
+			}))
+		})
+
+		DescribeTable("rejects invalid link entries", func(links string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, links)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the PCI address is malformed", `[{"deviceID": "03:02.0"}, {"deviceID": "0000:03:02.1"}]`),
+			Entry("when the PCI address is not a string", `[{"deviceID": 1}, {"deviceID": "0000:03:02.1"}]`),
+			Entry("when a link sets both name and deviceID", `[{"name": "net1", "deviceID": "0000:03:02.0"}, {"name": "net2"}]`),
+			Entry("when a link sets no selector", `[{"mtu": 1500}, {"name": "net2"}]`),
+		)
+	})
+
+	When("the bond is monitored by ARP", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "%s",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("builds the bond with the ARP monitor options", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "active-backup",
+				`"arpInterval": 200, "arpIpTargets": ["192.168.1.1", "192.168.1.2"], "arpValidate": "filter_active", "arpAllTargets": "all", "arpMissedMax": 3,`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.Miimon).To(Equal(0))
+			Expect(bondLinkObj.ArpInterval).To(Equal(200))
+			Expect(bondLinkObj.ArpIpTargets).To(Equal([]net.IP{net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.2")}))
+			Expect(bondLinkObj.ArpValidate).To(Equal(netlink.BondArpValidate(5)))
+			Expect(bondLinkObj.ArpAllTargets).To(Equal(netlink.BOND_ARP_ALL_TARGETS_ALL))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+
+		DescribeTable("rejects invalid ARP monitor options", func(mode, options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when miimon is also set", "active-backup", `"miimon": "100", "arpInterval": 200, "arpIpTargets": ["192.168.1.1"],`),
+			Entry("when the mode is 802.3ad", "802.3ad", `"arpInterval": 200, "arpIpTargets": ["192.168.1.1"],`),
+			Entry("when the mode is balance-alb", "balance-alb", `"arpInterval": 200, "arpIpTargets": ["192.168.1.1"],`),
+			Entry("when no target is set", "active-backup", `"arpInterval": 200,`),
+			Entry("when a target is IPv6", "active-backup", `"arpInterval": 200, "arpIpTargets": ["2001:db8::1"],`),
+			Entry("when targets are set without arpInterval", "active-backup", `"miimon": "100", "arpIpTargets": ["192.168.1.1"],`),
+			Entry("when arpValidate is unknown", "active-backup", `"arpInterval": 200, "arpIpTargets": ["192.168.1.1"], "arpValidate": "strict",`),
+			Entry("when arpAllTargets is unknown", "active-backup", `"arpInterval": 200, "arpIpTargets": ["192.168.1.1"], "arpAllTargets": "some",`),
+			Entry("when arpMissedMax is out of range", "active-backup", `"arpInterval": 200, "arpIpTargets": ["192.168.1.1"], "arpMissedMax": 0,`),
+			Entry("when arpTargetsFromIPAM is set without IPAM", "active-backup", `"arpInterval": 200, "arpTargetsFromIPAM": true,`),
+			Entry("when arpTargetsFromIPAM is set without arpInterval", "active-backup", `"miimon": "100", "arpTargetsFromIPAM": true, "ipam": {"type": "static"},`),
+			Entry("when an NS target is IPv4", "active-backup", `"arpInterval": 200, "nsIp6Targets": ["192.168.1.1"],`),
+			Entry("when an NS target is multicast", "active-backup", `"arpInterval": 200, "nsIp6Targets": ["ff02::1"],`),
+			Entry("when an NS target is unspecified", "active-backup", `"arpInterval": 200, "nsIp6Targets": ["::"],`),
+			Entry("when NS targets are set without arpInterval", "active-backup", `"miimon": "100", "nsIp6Targets": ["2001:db8::1"],`),
+		)
+
+		It("accepts a bond monitored by NS targets only", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "active-backup",
+				`"arpInterval": 200, "nsIp6Targets": ["2001:db8::1", "fe80::1"],`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.NsIp6Targets).To(Equal([]string{"2001:db8::1", "fe80::1"}))
+		})
+
+		It("adds the IPv4 gateways of the bond addresses to the ARP targets", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "active-backup",
+				`"arpInterval": 200, "arpIpTargets": ["192.168.1.1"], "arpTargetsFromIPAM": true, "ipam": {"type": "static"},`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			ipamResult := &types100.Result{
+				IPs: []*types100.IPConfig{
+					{Interface: types100.Int(1), Address: net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}, Gateway: net.ParseIP("192.168.1.1")},
+					{Interface: types100.Int(1), Address: net.IPNet{IP: net.ParseIP("10.0.0.10"), Mask: net.CIDRMask(24, 32)}, Gateway: net.ParseIP("10.0.0.1")},
+					{Interface: types100.Int(1), Address: net.IPNet{IP: net.ParseIP("2001:db8::10"), Mask: net.CIDRMask(64, 128)}, Gateway: net.ParseIP("2001:db8::1")},
+					{Interface: types100.Int(0), Address: net.IPNet{IP: net.ParseIP("172.16.0.10"), Mask: net.CIDRMask(24, 32)}, Gateway: net.ParseIP("172.16.0.1")},
+				},
+			}
+			Expect(addArpTargetsFromResult(bondConf, ipamResult, 1)).To(Succeed())
+			Expect(bondConf.ArpIpTargets).To(Equal([]string{"192.168.1.1", "10.0.0.1"}))
+		})
+
+		It("fails when the IPAM result holds no IPv4 gateway", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "active-backup",
+				`"arpInterval": 200, "arpTargetsFromIPAM": true, "ipam": {"type": "static"},`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			ipamResult := &types100.Result{
+				IPs: []*types100.IPConfig{
+					{Interface: types100.Int(0), Address: net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}},
+				},
+			}
+			Expect(addArpTargetsFromResult(bondConf, ipamResult, 0)).NotTo(Succeed())
+		})
+	})
+
+	When("the bond delays link state changes", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("builds the bond with the delays", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, `"miimon": "100", "updelay": 200, "downdelay": 100, "peerNotifDelay": 300,`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.UpDelay).To(Equal(200))
+			Expect(bondLinkObj.DownDelay).To(Equal(100))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+
+		It("rejects a peer notification delay with ARP monitoring", func() {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, `"arpInterval": 250, "arpIpTargets": ["192.168.1.1"], "peerNotifDelay": 500,`)), IfName)
+			Expect(err).To(MatchError(ContainSubstring("peerNotifDelay: peerNotifDelay requires miimon to be set")))
+		})
+
+		DescribeTable("rejects invalid delays", func(options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when updelay is not a multiple of miimon", `"miimon": "100", "updelay": 150,`),
+			Entry("when downdelay is negative", `"miimon": "100", "downdelay": -100,`),
+			Entry("when updelay is set without miimon", `"miimon": "0", "updelay": 100,`),
+			Entry("when downdelay is set with ARP monitoring", `"arpInterval": 100, "arpIpTargets": ["192.168.1.1"], "downdelay": 100,`),
+			Entry("when peerNotifDelay is not a multiple of miimon", `"miimon": "100", "peerNotifDelay": 250,`),
+			Entry("when updelay is zero with ARP monitoring", `"arpInterval": 100, "arpIpTargets": ["192.168.1.1"], "updelay": 0,`),
+		)
+	})
+
+	When("the bond notifies peers after a failover", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		DescribeTable("builds the bond with the number of notifications", func(options string, expectedNumPeerNotif, expectedResendIgmp int) {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, options)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.NumPeerNotif).To(Equal(expectedNumPeerNotif))
+			Expect(bondLinkObj.ResendIgmp).To(Equal(expectedResendIgmp))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		},
+			Entry("when numGratArp is set", `"numGratArp": 5, "resendIgmp": 3,`, 5, 3),
+			Entry("when numUnsolNa is set", `"numUnsolNa": 2,`, 2, -1),
+			Entry("when both are set to the same value", `"numGratArp": 4, "numUnsolNa": 4,`, 4, -1),
+		)
+
+		DescribeTable("rejects invalid numbers of notifications", func(options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when numGratArp is out of range", `"numGratArp": 256,`),
+			Entry("when resendIgmp is negative", `"resendIgmp": -1,`),
+			Entry("when numGratArp and numUnsolNa differ", `"numGratArp": 1, "numUnsolNa": 2,`),
+		)
+	})
+
+	When("the bond balances the load", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "%s",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		DescribeTable("builds the bond with the load balancing options", func(mode, options string, expectedPacketsPerSlave, expectedLpInterval int) {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.PacketsPerSlave).To(Equal(expectedPacketsPerSlave))
+			Expect(bondLinkObj.LpInterval).To(Equal(expectedLpInterval))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		},
+			Entry("when packetsPerSlave is set in balance-rr mode", "balance-rr", `"packetsPerSlave": 0,`, 0, -1),
+			Entry("when lpInterval is set in balance-tlb mode", "balance-tlb", `"lpInterval": 5,`, -1, 5),
+			Entry("when lpInterval is set in balance-alb mode", "balance-alb", `"lpInterval": 1,`, -1, 1),
+		)
+
+		DescribeTable("rejects invalid load balancing options", func(mode, options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when packetsPerSlave is set in another mode", "balance-xor", `"packetsPerSlave": 2,`),
+			Entry("when packetsPerSlave is out of range", "balance-rr", `"packetsPerSlave": 65536,`),
+			Entry("when lpInterval is set in another mode", "active-backup", `"lpInterval": 1,`),
+			Entry("when lpInterval is zero", "balance-alb", `"lpInterval": 0,`),
+		)
+	})
+
+	When("the bond is an 802.3ad bond", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "%s",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("builds the bond with the LACP options", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "802.3ad",
+				`"lacpRate": "fast", "adSelect": "bandwidth", "adActorSysPrio": 100, "adUserPortKey": 5, "adActorSystem": "02:00:00:00:00:01",`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.LacpRate).To(Equal(netlink.BOND_LACP_RATE_FAST))
+			Expect(bondLinkObj.AdSelect).To(Equal(netlink.BOND_AD_SELECT_BANDWIDTH))
+			Expect(bondLinkObj.AdActorSysPrio).To(Equal(100))
+			Expect(bondLinkObj.AdUserPortKey).To(Equal(5))
+			Expect(bondLinkObj.AdActorSystem).To(Equal(net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+
+		DescribeTable("rejects invalid LACP options", func(mode, options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the mode is not 802.3ad", "active-backup", `"lacpRate": "fast",`),
+			Entry("when lacpRate is unknown", "802.3ad", `"lacpRate": "medium",`),
+			Entry("when lacpActive is unknown", "802.3ad", `"lacpActive": "passive",`),
+			Entry("when adSelect is unknown", "802.3ad", `"adSelect": "random",`),
+			Entry("when adActorSysPrio is out of range", "802.3ad", `"adActorSysPrio": 0,`),
+			Entry("when adUserPortKey is out of range", "802.3ad", `"adUserPortKey": 1024,`),
+			Entry("when adActorSystem is multicast", "802.3ad", `"adActorSystem": "01:00:5e:00:00:01",`),
+			Entry("when adActorSystem is zero", "802.3ad", `"adActorSystem": "00:00:00:00:00:00",`),
+			Entry("when adActorSystem is malformed", "802.3ad", `"adActorSystem": "02:00:00",`),
+			Entry("when minLinks is set in another mode", "balance-xor", `"minLinks": 1,`),
+			Entry("when minLinks exceeds the number of links", "802.3ad", `"minLinks": 3,`),
+			Entry("when minLinks is negative", "802.3ad", `"minLinks": -1,`),
+		)
+
+		It("builds the bond with the minimum number of active links", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "802.3ad", `"minLinks": 2,`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.MinLinks).To(Equal(2))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+	})
+
+	When("the bond has a primary slave", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "%s",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("builds the bond with the primary reselection policy", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "active-backup",
+				`"primary": 1, "primaryReselect": "failure", "activeSlave": 1,`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondLinkObj.PrimaryReselect).To(Equal(netlink.BOND_PRIMARY_RESELECT_FAILURE))
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+
+		DescribeTable("rejects invalid primary options", func(mode, options string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, mode, options)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the mode has no active slave", "balance-rr", `"primary": 0,`),
+			Entry("when primary is not a link entry", "active-backup", `"primary": 2,`),
+			Entry("when activeSlave is not a link entry", "balance-tlb", `"activeSlave": -1,`),
+			Entry("when primaryReselect is unknown", "active-backup", `"primary": 0, "primaryReselect": "never",`),
+		)
+	})
+
+	When("links are selected by attributes", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			"links": %s
+		}`
+
+		DescribeTable("converts the link entry to a selector", func(link string, expectedSelector *util.LinkSelector) {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "["+link+`, {"name": "net2"}]`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hasLinkSelector(bondConf.Links[0])).To(BeTrue())
+
+			selector, err := linkSelectorFromConfig(bondConf.Links[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector).To(Equal(expectedSelector))
+		},
+			Entry("when selecting by MAC address", `{"mac": "0A:00:00:00:00:01"}`,
+				&util.LinkSelector{MAC: net.HardwareAddr{0x0a, 0, 0, 0, 0, 1}}),
+			Entry("when selecting by name glob and driver", `{"nameGlob": "ens*f0v*", "driver": "iavf"}`,
+				&util.LinkSelector{NameGlob: "ens*f0v*", Driver: "iavf"}),
+			Entry("when selecting by altName and alias", `{"altName": "enp3s0f0", "alias": "uplink-a"}`,
+				&util.LinkSelector{AltName: "enp3s0f0", Alias: "uplink-a"}),
+			Entry("when selecting by pciAddress", `{"pciAddress": "0000:03:02.0"}`,
+				&util.LinkSelector{PCIAddress: "0000:03:02.0"}),
+		)
+
+		DescribeTable("rejects invalid selectors", func(link string) {
+			_, _, err := loadAddConfig([]byte(fmt.Sprintf(config, "["+link+`, {"name": "net2"}]`)), IfName)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the MAC address is malformed", `{"mac": "0A:00:00"}`),
+			Entry("when the name glob is malformed", `{"nameGlob": "ens[f0"}`),
+			Entry("when the selector is empty", `{"driver": ""}`),
+			Entry("when both pciAddress and deviceID are set", `{"pciAddress": "0000:03:02.0", "deviceID": "0000:03:02.0"}`),
+			Entry("when name is combined with a selector", `{"name": "net1", "driver": "iavf"}`),
+		)
+	})
+
+	When("the running kernel is probed", func() {
+		DescribeTable("parses the kernel release", func(release string, expected util.KernelVersion) {
+			version, err := util.ParseKernelRelease(release)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(expected))
+		},
+			Entry("when the release is a stable kernel", "6.8.0-45-generic", util.KernelVersion{Major: 6, Minor: 8}),
+			Entry("when the release is a distribution kernel", "5.14.0-427.13.1.el9_4.x86_64", util.KernelVersion{Major: 5, Minor: 14}),
+			Entry("when the release is a release candidate", "6.1-rc2", util.KernelVersion{Major: 6, Minor: 1}),
+		)
+
+		DescribeTable("fails to parse an invalid kernel release", func(release string) {
+			_, err := util.ParseKernelRelease(release)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("when the release has no minor version", "6"),
+			Entry("when the release is not numeric", "linux.next"),
+		)
+
+		It("rejects the options the running kernel did not report back", func() {
+			bondConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "active-backup",
+				"arpInterval": 200,
+				"arpIpTargets": ["192.168.1.1"],
+				"arpMissedMax": 3,
+				"nsIp6Targets": ["fd00::1"],
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+
+			errs := &configErrors{}
+			validateKernelSupport(bondConf, map[uint16][]byte{unix.IFLA_BOND_NS_IP6_TARGET: {}}, "5.14", errs)
+			Expect(errs.asError()).To(MatchError(ContainSubstring("arpMissedMax is not supported by the running kernel (5.14), it requires kernel 5.17 or later")))
+			Expect(*errs).To(HaveLen(1))
+		})
+
+		DescribeTable("checks the running kernel knows the xmitHashPolicy", func(policy string, kernel util.KernelVersion, expectedError string) {
+			errs := &configErrors{}
+			validateXmitHashPolicySupport(&bondingConfig{XmitHashPolicy: &policy}, kernel, errs)
+			if expectedError == "" {
+				Expect(*errs).To(BeEmpty())
+			} else {
+				Expect(errs.asError()).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+			Entry("when the policy is known to every kernel", "layer3+4", util.KernelVersion{Major: 3, Minor: 10}, ""),
+			Entry("when the kernel adds the policy", "vlan+srcmac", util.KernelVersion{Major: 5, Minor: 12}, ""),
+			Entry("when the kernel predates the policy", "vlan+srcmac", util.KernelVersion{Major: 5, Minor: 10},
+				"xmitHashPolicy vlan+srcmac is not supported by the running kernel (5.10), it requires kernel 5.12 or later"),
+			Entry("when the kernel predates an encap policy", "encap2+3", util.KernelVersion{Major: 3, Minor: 10},
+				"xmitHashPolicy encap2+3 is not supported by the running kernel (3.10), it requires kernel 3.18 or later"),
+		)
+	})
+
+	When("the bonding module is checked before ADD", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			%s
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("loads the module only when asked to", func() {
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, ``)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.LoadBondingModule).To(BeFalse())
+
+			bondConf, _, err = loadAddConfig([]byte(fmt.Sprintf(config, `"loadBondingModule": true,`)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.LoadBondingModule).To(BeTrue())
+		})
+
+		It("returns an actionable error when the module is not available", func() {
+			available, err := util.IsBondingModuleAvailable()
+			Expect(err).NotTo(HaveOccurred())
+			if available {
+				Skip("the bonding module is available on this node")
+			}
+
+			bondConf, _, err := loadAddConfig([]byte(fmt.Sprintf(config, ``)), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			err = ensureBondingModule(bondConf)
+			var cniErr *types.Error
+			Expect(errors.As(err, &cniErr)).To(BeTrue())
+			Expect(cniErr.Code).To(Equal(errBondingModuleUnavailable))
+			Expect(cniErr.Details).To(ContainSubstring("modprobe bonding"))
+		})
+	})
+
+	When("the bond is read back after ADD", func() {
+		const config = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "balance-tlb",
+			"miimon": "100",
+			"mtu": 1400,
+			"failOverMac": 1,
+			"allSlavesActive": 1,
+			"tlbDynamicLb": 0,
+			"xmitHashPolicy": "layer3+4",
+			"links": [{"name": "net1"}, {"name": "net2"}]
+		}`
+
+		It("accepts a bond with every option applied", func() {
+			bondConf, _, err := loadAddConfig([]byte(config), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(Succeed())
+		})
+
+		DescribeTable("rejects a bond the kernel did not apply an option to", func(ignoreOption func(*netlink.Bond), expectedError string) {
+			bondConf, _, err := loadAddConfig([]byte(config), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			bondLinkObj, err := newBondLinkObj("bond0", bondConf)
+			Expect(err).NotTo(HaveOccurred())
+			ignoreOption(bondLinkObj)
+			Expect(validateBondConf(bondLinkObj, bondConf)).To(MatchError(ContainSubstring(expectedError)))
+		},
+			Entry("when the mode differs", func(b *netlink.Bond) { b.Mode = netlink.BOND_MODE_ACTIVE_BACKUP }, "mode mismatch"),
+			Entry("when miimon differs", func(b *netlink.Bond) { b.Miimon = 0 }, "miimon mismatch"),
+			Entry("when the MTU differs", func(b *netlink.Bond) { b.MTU = 1500 }, "mtu mismatch"),
+			Entry("when failOverMac differs", func(b *netlink.Bond) { b.FailOverMac = netlink.BOND_FAIL_OVER_MAC_NONE }, "failOverMac mismatch"),
+			Entry("when allSlavesActive differs", func(b *netlink.Bond) { b.AllSlavesActive = 0 }, "allSlavesActive mismatch"),
+			Entry("when tlbDynamicLb differs", func(b *netlink.Bond) { b.TlbDynamicLb = 1 }, "tlbDynamicLb mismatch"),
+			Entry("when xmitHashPolicy differs", func(b *netlink.Bond) { b.XmitHashPolicy = netlink.BOND_XMIT_HASH_POLICY_LAYER2 }, "xmitHashPolicy mismatch"),
+		)
+	})
+
+	When("the configuration has several problems", func() {
+		It("reports them all in a single CNI error", func() {
+			_, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "round-robin",
+				"miimon": "fast",
+				"failOverMac": 3,
+				"allSlavesActive": 2,
+				"xmitHashPolicy": "layer5",
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), IfName)
+			var cniErr *types.Error
+			Expect(errors.As(err, &cniErr)).To(BeTrue())
+			Expect(cniErr.Code).To(Equal(uint(types.ErrInvalidNetworkConfig)))
+			Expect(cniErr.Msg).To(Equal("invalid bond configuration, 5 error(s)"))
+			Expect(cniErr.Details).To(ContainSubstring("mode: bonding mode (round-robin) is not supported"))
+			Expect(cniErr.Details).To(ContainSubstring("miimon: failed to convert bondMiimon value (fast)"))
+			Expect(cniErr.Details).To(ContainSubstring("failOverMac: failOverMac should be between 0 and 2"))
+			Expect(cniErr.Details).To(ContainSubstring("allSlavesActive: allSlavesActive should be between 0 and 1"))
+			Expect(cniErr.Details).To(ContainSubstring("xmitHashPolicy: xmitHashPolicy is not supported"))
+		})
+
+		It("reports the problems of the links along with those of the options", func() {
+			_, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"mode": "bogus",
+				"miimon": "x",
+				"links": [{"mtu": 1}]
+			}`), IfName)
+			var cniErr *types.Error
+			Expect(errors.As(err, &cniErr)).To(BeTrue())
+			Expect(cniErr.Code).To(Equal(uint(types.ErrInvalidNetworkConfig)))
+			Expect(cniErr.Msg).To(Equal("invalid bond configuration, 4 error(s)"))
+			Expect(cniErr.Details).To(ContainSubstring("links[0]: link (map[mtu:1]) should set either name"))
+			Expect(cniErr.Details).To(ContainSubstring("links: bonding requires at least two links, actual: 1"))
+			Expect(cniErr.Details).To(ContainSubstring("mode: bonding mode (bogus) is not supported"))
+			Expect(cniErr.Details).To(ContainSubstring("miimon: failed to convert bondMiimon value (x)"))
+		})
+
+		It("reports a bond without links, from the configuration or prevResult", func() {
+			_, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"configVersion": 2,
+				"bondOptions": {"mode": "active-backup", "miimon": "100"}
+			}`), IfName)
+			Expect(err).To(MatchError(ContainSubstring("links: bonding requires at least two links, actual: 0")))
+		})
+
+		DescribeTable("reports a configuration which cannot be decoded apart from the invalid options", func(config string) {
+			_, _, err := loadAddConfig([]byte(config), IfName)
+			var cniErr *types.Error
+			Expect(errors.As(err, &cniErr)).To(BeTrue())
+			Expect(cniErr.Code).To(Equal(uint(types.ErrDecodingFailure)))
+		},
+			Entry("when the configuration is not JSON", `{"name": "bond", "type": "bond",`),
+			Entry("when an option has the wrong type",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "mode": "active-backup", "miimon": "100", "failOverMac": "active",
+				"links": [{"name": "net1"}, {"name": "net2"}]}`),
+			Entry("when the prevResult is malformed",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "mode": "active-backup", "miimon": "100",
+				"prevResult": {"interfaces": "eth0"}, "links": [{"name": "net1"}, {"name": "net2"}]}`),
+		)
+	})
+
+	When("the configuration uses version 2", func() {
+		const configV1 = `{
+			"name": "bond",
+			"type": "bond",
+			"cniVersion": "1.0.0",
+			"mode": "active-backup",
+			"miimon": "100",
+			"allSlavesActive": 1,
+			"primary": 1,
+			"links": [{"name": "net1"}, {"name": "net2"}, {"resultIndex": 0}]
+		}`
+
+		It("converts typed fields to the version 1 configuration", func() {
+			bondConfV1 := &bondingConfig{}
+			Expect(json.Unmarshal([]byte(configV1), bondConfV1)).To(Succeed())
+
+			errs := &configErrors{}
+			bondConfV2, err := decodeBondingConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"configVersion": 2,
+				"mode": "active-backup",
+				"miimon": 100,
+				"allSlavesActive": true,
+				"primary": 1,
+				"links": [{"name": "net1"}, {"name": "net2"}, {"resultIndex": 0}]
+			}`), errs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*errs).To(BeEmpty())
+			Expect(bondConfV2).To(Equal(bondConfV1))
+		})
+
+		It("keeps version 1 configurations working unchanged", func() {
+			bondConf, _, err := loadAddConfig([]byte(configV1), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.Miimon).To(Equal("100"))
+			Expect(*bondConf.AllSlavesActive).To(Equal(1))
+			Expect(bondConf.Links).To(Equal([]map[string]interface{}{{"name": "net1"}, {"name": "net2"}, {"resultIndex": float64(0)}}))
+		})
+
+		It("takes the options of the bondOptions block under their iproute2 names", func() {
+			bondConf, _, err := loadAddConfig([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.0.0",
+				"configVersion": 2,
+				"links": [{"name": "net1"}, {"mac": "02:00:00:00:00:02"}],
+				"bondOptions": {
+					"mode": "active-backup",
+					"miimon": "100",
+					"updelay": 200,
+					"fail_over_mac": "active",
+					"primary": "net1",
+					"primary_reselect": "failure",
+					"num_grat_arp": 3,
+					"all_slaves_active": false
+				}
+			}`), IfName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bondConf.Mode).To(Equal("active-backup"))
+			Expect(bondConf.Miimon).To(Equal("100"))
+			Expect(*bondConf.UpDelay).To(Equal(200))
+			Expect(bondConf.FailOverMac).To(Equal(1))
+			Expect(*bondConf.Primary).To(Equal(0))
+			Expect(*bondConf.PrimaryReselect).To(Equal("failure"))
+			Expect(*bondConf.NumGratArp).To(Equal(3))
+			Expect(*bondConf.AllSlavesActive).To(Equal(0))
+			Expect(bondConf.Links[1]).To(Equal(map[string]interface{}{"mac": "02:00:00:00:00:02"}))
+		})
+
+		DescribeTable("rejects an invalid version 2 configuration", func(config, expectedError string) {
+			_, _, err := loadAddConfig([]byte(config), IfName)
+			Expect(err).To(MatchError(ContainSubstring(expectedError)))
+		},
+			Entry("when an option is set both at the top level and in bondOptions",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"updelay": 100, "bondOptions": {"updelay": 200}, "links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"bondOptions.updelay: updelay is also set at the top level as updelay"),
+			Entry("when fail_over_mac is unknown",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"bondOptions": {"fail_over_mac": "always"}, "links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"fail_over_mac should be none, active or follow"),
+			Entry("when primary does not name a link entry",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"bondOptions": {"primary": "net3"}, "links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"primary should be the name of a link entry"),
+			Entry("when a flag is neither a boolean nor an integer",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"allSlavesActive": "yes", "links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"should be a boolean or an integer"),
+			Entry("when miimon is not an integer",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": "fast",
+				"links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"failed to convert bondMiimon value (fast)"),
+			Entry("when bondOptions is set in a version 1 configuration",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "mode": "active-backup", "miimon": "100",
+				"bondOptions": {"updelay": 200}, "links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"bondOptions requires configVersion 2"),
+			Entry("when configVersion is unknown",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 3, "mode": "active-backup", "miimon": "100",
+				"links": [{"name": "net1"}, {"name": "net2"}]}`,
+				"configVersion should be 1 or 2"),
+			Entry("when a link entry holds an unknown key",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"links": [{"name": "net1"}, {"nmae": "net2"}]}`,
+				`json: unknown field "nmae"`),
+			Entry("when primary names a link selected by attributes",
+				`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 2, "mode": "active-backup", "miimon": 100,
+				"bondOptions": {"primary": "net2"}, "links": [{"name": "net1"}, {"mac": "02:00:00:00:00:02"}]}`,
+				"links selected by attributes or resultIndex are set by index with the top level primary instead"),
+		)
+	})
+
+	When("the attachment state is recorded", func() {
+		It("keeps apart attachments whose container ID and interface name join the same way", func() {
+			dataDir := GinkgoT().TempDir()
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{ContainerID: "a-b", IfName: "c", Netns: "/var/run/netns/first"})).To(Succeed())
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{ContainerID: "a", IfName: "b-c", Netns: "/var/run/netns/second"})).To(Succeed())
+
+			state, err := util.LoadAttachmentState(dataDir, "a-b", "c")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Netns).To(Equal("/var/run/netns/first"))
+
+			Expect(util.DeleteAttachmentState(dataDir, "a", "b-c")).To(Succeed())
+			states, err := util.ListAttachmentStates(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(states).To(HaveLen(1))
+			Expect(states[0].ContainerID).To(Equal("a-b"))
+		})
+
+		It("passes through the status reported by the IPAM plugin", func() {
+			available, err := util.IsBondingModuleAvailable()
+			Expect(err).NotTo(HaveOccurred())
+			if !available {
+				Skip("the bonding module is not available")
+			}
+
+			// a fake IPAM plugin limited in the addresses it can allocate
+			cniPath := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(cniPath, "limited-ipam"),
+				[]byte("#!/bin/sh\necho '{\"cniVersion\": \"1.1.0\", \"code\": 51, \"msg\": \"no addresses left\"}'\nexit 1\n"), 0700)).To(Succeed())
+			GinkgoT().Setenv("CNI_PATH", cniPath)
+			GinkgoT().Setenv("CNI_COMMAND", "STATUS")
+
+			err = cmdStatus(&skel.CmdArgs{StdinData: []byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.1.0",
+				"mode": "active-backup",
+				"miimon": "100",
+				"linksInContainer": true,
+				"links": [{"name": "net1"}, {"name": "net2"}],
+				"ipam": {"type": "limited-ipam"}
+			}`)})
+			var cniErr *types.Error
+			Expect(errors.As(err, &cniErr)).To(BeTrue())
+			Expect(cniErr.Code).To(Equal(uint(51)))
+			Expect(cniErr.Msg).To(Equal("no addresses left"))
+		})
+
+		It("lists the readable states and reports the corrupt ones", func() {
+			dataDir := GinkgoT().TempDir()
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{ContainerID: "first", IfName: "bond0"})).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(dataDir, "second"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dataDir, "second", "bond0.json"), []byte(`{"containerId": `), 0600)).To(Succeed())
+
+			states, err := util.ListAttachmentStates(dataDir)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse attachment state")))
+			Expect(states).To(HaveLen(1))
+			Expect(states[0].ContainerID).To(Equal("first"))
+		})
+
+		It("reports a stale attachment of the network whose recorded configuration cannot be loaded", func() {
+			dataDir := GinkgoT().TempDir()
+			config := withDataDir([]byte(`{
+				"name": "bond",
+				"type": "bond",
+				"cniVersion": "1.1.0",
+				"mode": "active-backup",
+				"miimon": "100",
+				"links": [{"name": "net1"}, {"name": "net2"}]
+			}`), dataDir)
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{ContainerID: "mine", IfName: "bond0",
+				Config: []byte(`{"name": "bond", "type": "bond", "cniVersion": "1.0.0", "configVersion": 3}`)})).To(Succeed())
+			Expect(util.SaveAttachmentState(dataDir, &util.AttachmentState{ContainerID: "other", IfName: "bond0",
+				Config: []byte(`{"name": "other", "type": "bond", "cniVersion": "1.0.0", "configVersion": 3}`)})).To(Succeed())
+
+			err := cmdGC(&skel.CmdArgs{StdinData: buildGCConfig(config, []types.GCAttachment{})})
+			Expect(err).To(MatchError(ContainSubstring("failed to load the configuration recorded for attachment (mine/bond0)")))
+			Expect(err).NotTo(MatchError(ContainSubstring("other")))
+		})
+	})
+})
+
+func addLinksInNS(initNS ns.NetNS, links []netlink.LinkAttrs) {
+	for _, link := range links {
+		var err error
+		err = initNS.Do(func(ns.NetNS) error {
+			defer GinkgoRecover()
+			err = netlink.LinkAdd(&netlink.Dummy{
+				LinkAttrs: link,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+func buildPrevResultConfig(config []byte, r types.Result) []byte {
+	prevResult, err := types100.NewResultFromResult(r)
+	Expect(err).NotTo(HaveOccurred())
+
+	confMap := map[string]interface{}{}
+	Expect(json.Unmarshal(config, &confMap)).To(Succeed())
+	confMap["prevResult"] = prevResult
+
+	prevResultConfig, err := json.Marshal(confMap)
+	Expect(err).NotTo(HaveOccurred())
+	return prevResultConfig
+}
+
+func withDataDir(config []byte, dataDir string) []byte {
+	confMap := map[string]interface{}{}
+	Expect(json.Unmarshal(config, &confMap)).To(Succeed())
+	confMap["dataDir"] = dataDir
+
+	dataDirConfig, err := json.Marshal(confMap)
+	Expect(err).NotTo(HaveOccurred())
+	return dataDirConfig
+}
+
+func buildGCConfig(config []byte, validAttachments []types.GCAttachment) []byte {
+	confMap := map[string]interface{}{}
+	Expect(json.Unmarshal(config, &confMap)).To(Succeed())
+	confMap["cniVersion"] = "1.1.0"
+	confMap["cni.dev/valid-attachments"] = validAttachments
+
+	gcConfig, err := json.Marshal(confMap)
+	Expect(err).NotTo(HaveOccurred())
+	return gcConfig
 }
 
 func checkAddReturnResult(r *types.Result, bondIfName string) {
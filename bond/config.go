@@ -0,0 +1,335 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// configVersion 2 types the fields which version 1 configurations left loosely typed, and adds the bondOptions block.
+// both versions are converted to the same bondingConfig, so version 1 configurations keep working unchanged
+const (
+	configVersion1 = 1
+	configVersion2 = 2
+)
+
+// bondingConfigV2 shadows the loosely typed fields of bondingConfig, every other field keeps its version 1 shape
+type bondingConfigV2 struct {
+	bondingConfig
+	Miimon          intOrString  `json:"miimon"`
+	Links           []linkConfig `json:"links"`
+	AllSlavesActive *boolOrInt   `json:"allSlavesActive,omitempty"`
+	TlbDynamicLb    *boolOrInt   `json:"tlbDynamicLb,omitempty"`
+	BondOptions     *bondOptions `json:"bondOptions,omitempty"`
+}
+
+// linkConfig is a link entry of a version 2 configuration: the name of the link, the index of a prevResult interface
+// or the attributes selecting the link
+type linkConfig struct {
+	Name        string `json:"name,omitempty"`
+	ResultIndex *int   `json:"resultIndex,omitempty"`
+	NameGlob    string `json:"nameGlob,omitempty"`
+	MAC         string `json:"mac,omitempty"`
+	AltName     string `json:"altName,omitempty"`
+	Alias       string `json:"alias,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	PCIAddress  string `json:"pciAddress,omitempty"`
+	DeviceID    string `json:"deviceID,omitempty"`
+}
+
+// a link entry holds nothing else than the keys of linkConfig, so a misspelt selector is rejected rather than ignored
+func (l *linkConfig) UnmarshalJSON(data []byte) error {
+	// the plain type has no UnmarshalJSON, which would recurse
+	type plainLinkConfig linkConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode((*plainLinkConfig)(l)); err != nil {
+		return fmt.Errorf("link entry (%s) is invalid, error: %+v", data, err)
+	}
+	return nil
+}
+
+// bondOptions holds the bond options under their iproute2 names. primary and active_slave name a link entry
+type bondOptions struct {
+	Mode            *string      `json:"mode,omitempty"`
+	Miimon          *intOrString `json:"miimon,omitempty"`
+	UpDelay         *int         `json:"updelay,omitempty"`
+	DownDelay       *int         `json:"downdelay,omitempty"`
+	PeerNotifyDelay *int         `json:"peer_notify_delay,omitempty"`
+	ArpInterval     *int         `json:"arp_interval,omitempty"`
+	ArpIpTarget     []string     `json:"arp_ip_target,omitempty"`
+	NsIp6Target     []string     `json:"ns_ip6_target,omitempty"`
+	ArpValidate     *string      `json:"arp_validate,omitempty"`
+	ArpAllTargets   *string      `json:"arp_all_targets,omitempty"`
+	ArpMissedMax    *int         `json:"arp_missed_max,omitempty"`
+	Primary         *string      `json:"primary,omitempty"`
+	PrimaryReselect *string      `json:"primary_reselect,omitempty"`
+	ActiveSlave     *string      `json:"active_slave,omitempty"`
+	FailOverMac     *string      `json:"fail_over_mac,omitempty"`
+	XmitHashPolicy  *string      `json:"xmit_hash_policy,omitempty"`
+	ResendIgmp      *int         `json:"resend_igmp,omitempty"`
+	NumGratArp      *int         `json:"num_grat_arp,omitempty"`
+	NumUnsolNa      *int         `json:"num_unsol_na,omitempty"`
+	AllSlavesActive *boolOrInt   `json:"all_slaves_active,omitempty"`
+	MinLinks        *int         `json:"min_links,omitempty"`
+	LpInterval      *int         `json:"lp_interval,omitempty"`
+	PacketsPerSlave *int         `json:"packets_per_slave,omitempty"`
+	LacpRate        *string      `json:"lacp_rate,omitempty"`
+	LacpActive      *string      `json:"lacp_active,omitempty"`
+	AdSelect        *string      `json:"ad_select,omitempty"`
+	AdActorSysPrio  *int         `json:"ad_actor_sys_prio,omitempty"`
+	AdUserPortKey   *int         `json:"ad_user_port_key,omitempty"`
+	AdActorSystem   *string      `json:"ad_actor_system,omitempty"`
+	TlbDynamicLb    *boolOrInt   `json:"tlb_dynamic_lb,omitempty"`
+}
+
+// fail_over_mac values by their iproute2 names
+var failOverMacValues = map[string]int{
+	"none":   0,
+	"active": 1,
+	"follow": 2,
+}
+
+// intOrString is an integer which may also be written as a string, as miimon is in version 1 configurations.
+// the text is kept, so a string which is not an integer is reported along with the other configuration problems
+type intOrString string
+
+func (v *intOrString) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*v = intOrString(number)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("value (%s) should be an integer or a string", data)
+	}
+	*v = intOrString(text)
+	return nil
+}
+
+// boolOrInt is a flag which may be written as a boolean or as the 0 or 1 of version 1 configurations
+type boolOrInt int
+
+func (v *boolOrInt) UnmarshalJSON(data []byte) error {
+	var flag bool
+	if err := json.Unmarshal(data, &flag); err == nil {
+		*v = 0
+		if flag {
+			*v = 1
+		}
+		return nil
+	}
+	var number int
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("value (%s) should be a boolean or an integer", data)
+	}
+	*v = boolOrInt(number)
+	return nil
+}
+
+func (v *boolOrInt) intValue() *int {
+	if v == nil {
+		return nil
+	}
+	value := int(*v)
+	return &value
+}
+
+// decode the configuration in the shape of its configVersion. problems found while converting a version 2
+// configuration are added to errs. return the bondConf & error
+func decodeBondingConfig(data []byte, errs *configErrors) (*bondingConfig, error) {
+	header := struct {
+		ConfigVersion *int            `json:"configVersion"`
+		BondOptions   json.RawMessage `json:"bondOptions"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	if header.ConfigVersion == nil || *header.ConfigVersion == configVersion1 {
+		bondConf := &bondingConfig{}
+		if err := json.Unmarshal(data, bondConf); err != nil {
+			return nil, err
+		}
+		// version 1 would silently ignore the block
+		if header.BondOptions != nil {
+			errs.add("bondOptions", fmt.Errorf("bondOptions requires configVersion %+v", configVersion2))
+		}
+		return bondConf, nil
+	}
+
+	if *header.ConfigVersion != configVersion2 {
+		return nil, fmt.Errorf("configVersion should be %+v or %+v, actual: %+v", configVersion1, configVersion2, *header.ConfigVersion)
+	}
+	confV2 := &bondingConfigV2{}
+	if err := json.Unmarshal(data, confV2); err != nil {
+		return nil, err
+	}
+	return confV2.convert(errs), nil
+}
+
+// convert the version 2 configuration to the bondingConfig the plugin works with
+func (c *bondingConfigV2) convert(errs *configErrors) *bondingConfig {
+	bondConf := &c.bondingConfig
+	bondConf.Miimon = string(c.Miimon)
+	bondConf.AllSlavesActive = c.AllSlavesActive.intValue()
+	bondConf.TlbDynamicLb = c.TlbDynamicLb.intValue()
+
+	bondConf.Links = []map[string]interface{}{}
+	for _, link := range c.Links {
+		bondConf.Links = append(bondConf.Links, link.toMap())
+	}
+
+	if c.BondOptions != nil {
+		c.BondOptions.mergeInto(bondConf, errs)
+	}
+	return bondConf
+}
+
+// convert the link entry to the version 1 shape, holding only the keys set
+func (l linkConfig) toMap() map[string]interface{} {
+	link := map[string]interface{}{}
+	if l.ResultIndex != nil {
+		// json numbers are decoded as float64 in version 1 link entries
+		link["resultIndex"] = float64(*l.ResultIndex)
+	}
+	for key, value := range map[string]string{
+		"name":       l.Name,
+		"nameGlob":   l.NameGlob,
+		"mac":        l.MAC,
+		"altName":    l.AltName,
+		"alias":      l.Alias,
+		"driver":     l.Driver,
+		"pciAddress": l.PCIAddress,
+		"deviceID":   l.DeviceID,
+	} {
+		if value != "" {
+			link[key] = value
+		}
+	}
+	return link
+}
+
+// set the options of the block in the bondConf, an option may be set either in the block or at the top level
+func (o *bondOptions) mergeInto(bondConf *bondingConfig, errs *configErrors) {
+	if o.Mode != nil {
+		if bondConf.Mode != "" {
+			errs.add("bondOptions.mode", fmt.Errorf("mode is also set at the top level, set it only once"))
+		} else {
+			bondConf.Mode = *o.Mode
+		}
+	}
+
+	if o.Miimon != nil {
+		if bondConf.Miimon != "" {
+			errs.add("bondOptions.miimon", fmt.Errorf("miimon is also set at the top level, set it only once"))
+		} else {
+			bondConf.Miimon = string(*o.Miimon)
+		}
+	}
+
+	if o.FailOverMac != nil {
+		failOverMac, ok := failOverMacValues[*o.FailOverMac]
+		switch {
+		case !ok:
+			errs.add("bondOptions.fail_over_mac", fmt.Errorf("fail_over_mac should be none, active or follow, actual: %+v", *o.FailOverMac))
+		case bondConf.FailOverMac != 0:
+			errs.add("bondOptions.fail_over_mac", fmt.Errorf("fail_over_mac is also set at the top level as failOverMac, set it only once"))
+		default:
+			bondConf.FailOverMac = failOverMac
+		}
+	}
+
+	if len(o.ArpIpTarget) > 0 {
+		if len(bondConf.ArpIpTargets) > 0 {
+			errs.add("bondOptions.arp_ip_target", fmt.Errorf("arp_ip_target is also set at the top level as arpIpTargets, set it only once"))
+		} else {
+			bondConf.ArpIpTargets = o.ArpIpTarget
+		}
+	}
+
+	if len(o.NsIp6Target) > 0 {
+		if len(bondConf.NsIp6Targets) > 0 {
+			errs.add("bondOptions.ns_ip6_target", fmt.Errorf("ns_ip6_target is also set at the top level as nsIp6Targets, set it only once"))
+		} else {
+			bondConf.NsIp6Targets = o.NsIp6Target
+		}
+	}
+
+	mergeBondOption(errs, "updelay", "updelay", &bondConf.UpDelay, o.UpDelay)
+	mergeBondOption(errs, "downdelay", "downdelay", &bondConf.DownDelay, o.DownDelay)
+	mergeBondOption(errs, "peer_notify_delay", "peerNotifDelay", &bondConf.PeerNotifDelay, o.PeerNotifyDelay)
+	mergeBondOption(errs, "arp_interval", "arpInterval", &bondConf.ArpInterval, o.ArpInterval)
+	mergeBondOption(errs, "arp_validate", "arpValidate", &bondConf.ArpValidate, o.ArpValidate)
+	mergeBondOption(errs, "arp_all_targets", "arpAllTargets", &bondConf.ArpAllTargets, o.ArpAllTargets)
+	mergeBondOption(errs, "arp_missed_max", "arpMissedMax", &bondConf.ArpMissedMax, o.ArpMissedMax)
+	mergeBondOption(errs, "primary", "primary", &bondConf.Primary, linkEntryIndex(bondConf, "primary", "primary", o.Primary, errs))
+	mergeBondOption(errs, "primary_reselect", "primaryReselect", &bondConf.PrimaryReselect, o.PrimaryReselect)
+	mergeBondOption(errs, "active_slave", "activeSlave", &bondConf.ActiveSlave, linkEntryIndex(bondConf, "active_slave", "activeSlave", o.ActiveSlave, errs))
+	mergeBondOption(errs, "xmit_hash_policy", "xmitHashPolicy", &bondConf.XmitHashPolicy, o.XmitHashPolicy)
+	mergeBondOption(errs, "resend_igmp", "resendIgmp", &bondConf.ResendIgmp, o.ResendIgmp)
+	mergeBondOption(errs, "num_grat_arp", "numGratArp", &bondConf.NumGratArp, o.NumGratArp)
+	mergeBondOption(errs, "num_unsol_na", "numUnsolNa", &bondConf.NumUnsolNa, o.NumUnsolNa)
+	mergeBondOption(errs, "all_slaves_active", "allSlavesActive", &bondConf.AllSlavesActive, o.AllSlavesActive.intValue())
+	mergeBondOption(errs, "min_links", "minLinks", &bondConf.MinLinks, o.MinLinks)
+	mergeBondOption(errs, "lp_interval", "lpInterval", &bondConf.LpInterval, o.LpInterval)
+	mergeBondOption(errs, "packets_per_slave", "packetsPerSlave", &bondConf.PacketsPerSlave, o.PacketsPerSlave)
+	mergeBondOption(errs, "lacp_rate", "lacpRate", &bondConf.LacpRate, o.LacpRate)
+	mergeBondOption(errs, "lacp_active", "lacpActive", &bondConf.LacpActive, o.LacpActive)
+	mergeBondOption(errs, "ad_select", "adSelect", &bondConf.AdSelect, o.AdSelect)
+	mergeBondOption(errs, "ad_actor_sys_prio", "adActorSysPrio", &bondConf.AdActorSysPrio, o.AdActorSysPrio)
+	mergeBondOption(errs, "ad_user_port_key", "adUserPortKey", &bondConf.AdUserPortKey, o.AdUserPortKey)
+	mergeBondOption(errs, "ad_actor_system", "adActorSystem", &bondConf.AdActorSystem, o.AdActorSystem)
+	mergeBondOption(errs, "tlb_dynamic_lb", "tlbDynamicLb", &bondConf.TlbDynamicLb, o.TlbDynamicLb.intValue())
+}
+
+// set the top level field to the value of the option from the block, unless the top level sets it too
+func mergeBondOption[T any](errs *configErrors, option, field string, topLevel **T, value *T) {
+	if value == nil {
+		return
+	}
+	if *topLevel != nil {
+		errs.add("bondOptions."+option, fmt.Errorf("%+v is also set at the top level as %+v, set it only once", option, field))
+		return
+	}
+	*topLevel = value
+}
+
+// return the index of the link entry named linkName, as the primary and the active slave are referenced at the top level.
+// links selected by attributes or resultIndex are only named once resolved, they are referenced by index at the top level instead
+func linkEntryIndex(bondConf *bondingConfig, option, field string, linkName *string, errs *configErrors) *int {
+	if linkName == nil {
+		return nil
+	}
+	unnamed := false
+	for i, link := range bondConf.Links {
+		if link["name"] == *linkName {
+			return &i
+		}
+		if _, ok := link["name"]; !ok {
+			unnamed = true
+		}
+	}
+	if unnamed {
+		errs.add("bondOptions."+option, fmt.Errorf("%+v should be the name of a link entry, actual: %+v, links selected by attributes or resultIndex are set by index with the top level %+v instead",
+			option, *linkName, field))
+		return nil
+	}
+	errs.add("bondOptions."+option, fmt.Errorf("%+v should be the name of a link entry, actual: %+v", option, *linkName))
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/intel/bond-cni/bond/util"
+)
+
+// modes sharing the bonding driver features an option depends on
+var (
+	activeSlaveModes = []netlink.BondMode{netlink.BOND_MODE_ACTIVE_BACKUP, netlink.BOND_MODE_BALANCE_TLB, netlink.BOND_MODE_BALANCE_ALB}
+	arpMonitorModes  = []netlink.BondMode{netlink.BOND_MODE_BALANCE_RR, netlink.BOND_MODE_ACTIVE_BACKUP, netlink.BOND_MODE_BALANCE_XOR, netlink.BOND_MODE_BROADCAST}
+	hashModes        = []netlink.BondMode{netlink.BOND_MODE_BALANCE_XOR, netlink.BOND_MODE_802_3AD, netlink.BOND_MODE_BALANCE_TLB}
+	tlbModes         = []netlink.BondMode{netlink.BOND_MODE_BALANCE_TLB, netlink.BOND_MODE_BALANCE_ALB}
+	lacpModes        = []netlink.BondMode{netlink.BOND_MODE_802_3AD}
+	roundRobinModes  = []netlink.BondMode{netlink.BOND_MODE_BALANCE_RR}
+)
+
+// bondOptionRule describes the modes an option applies to, nil meaning every mode, the range of an integer option
+// and the IFLA_BOND attribute of options which older kernels do not know, so the bond is read back to check them,
+// with the upstream kernel adding it. isSet reports whether the option is configured, value returns the integer
+// option or nil when it is not configured
+type bondOptionRule struct {
+	name      string
+	modes     []netlink.BondMode
+	isSet     func(bondConf *bondingConfig) bool
+	value     func(bondConf *bondingConfig) *int
+	min, max  int
+	attribute uint16
+	minKernel util.KernelVersion
+}
+
+var bondOptionRules = []bondOptionRule{
+	// failOverMac defaults to 0, which every mode accepts
+	{name: "failOverMac", modes: activeSlaveModes, value: func(c *bondingConfig) *int { return nonZero(c.FailOverMac) }, min: 0, max: 2},
+	{name: "allSlavesActive", value: func(c *bondingConfig) *int { return c.AllSlavesActive }, min: 0, max: 1},
+	{name: "tlbDynamicLb", modes: tlbModes, value: func(c *bondingConfig) *int { return c.TlbDynamicLb }, min: 0, max: 1, attribute: unix.IFLA_BOND_TLB_DYNAMIC_LB, minKernel: util.KernelVersion{Major: 4, Minor: 3}},
+	{name: "xmitHashPolicy", modes: hashModes, isSet: func(c *bondingConfig) bool { return c.XmitHashPolicy != nil }},
+
+	{name: "arpInterval", modes: arpMonitorModes, value: func(c *bondingConfig) *int { return c.ArpInterval }, min: 0, max: math.MaxInt32},
+	{name: "arpIpTargets", modes: arpMonitorModes, isSet: func(c *bondingConfig) bool { return len(c.ArpIpTargets) > 0 }},
+	{name: "arpValidate", modes: arpMonitorModes, isSet: func(c *bondingConfig) bool { return c.ArpValidate != nil }},
+	{name: "arpAllTargets", modes: arpMonitorModes, isSet: func(c *bondingConfig) bool { return c.ArpAllTargets != nil }},
+	{name: "arpMissedMax", modes: arpMonitorModes, value: func(c *bondingConfig) *int { return c.ArpMissedMax }, min: 1, max: 255, attribute: unix.IFLA_BOND_MISSED_MAX, minKernel: util.KernelVersion{Major: 5, Minor: 17}},
+	{name: "arpTargetsFromIPAM", modes: arpMonitorModes, isSet: func(c *bondingConfig) bool { return c.ArpTargetsFromIPAM }},
+	{name: "nsIp6Targets", modes: arpMonitorModes, isSet: func(c *bondingConfig) bool { return len(c.NsIp6Targets) > 0 }, attribute: unix.IFLA_BOND_NS_IP6_TARGET, minKernel: util.KernelVersion{Major: 5, Minor: 19}},
+
+	{name: "updelay", value: func(c *bondingConfig) *int { return c.UpDelay }, min: 0, max: math.MaxInt32},
+	{name: "downdelay", value: func(c *bondingConfig) *int { return c.DownDelay }, min: 0, max: math.MaxInt32},
+	{name: "peerNotifDelay", value: func(c *bondingConfig) *int { return c.PeerNotifDelay }, min: 0, max: math.MaxInt32, attribute: unix.IFLA_BOND_PEER_NOTIF_DELAY, minKernel: util.KernelVersion{Major: 5, Minor: 3}},
+
+	{name: "primary", modes: activeSlaveModes, isSet: func(c *bondingConfig) bool { return c.Primary != nil }},
+	{name: "primaryReselect", modes: activeSlaveModes, isSet: func(c *bondingConfig) bool { return c.PrimaryReselect != nil }},
+	{name: "activeSlave", modes: activeSlaveModes, isSet: func(c *bondingConfig) bool { return c.ActiveSlave != nil }},
+
+	{name: "numGratArp", value: func(c *bondingConfig) *int { return c.NumGratArp }, min: 0, max: 255},
+	{name: "numUnsolNa", value: func(c *bondingConfig) *int { return c.NumUnsolNa }, min: 0, max: 255},
+	{name: "resendIgmp", value: func(c *bondingConfig) *int { return c.ResendIgmp }, min: 0, max: 255},
+
+	{name: "packetsPerSlave", modes: roundRobinModes, value: func(c *bondingConfig) *int { return c.PacketsPerSlave }, min: 0, max: 65535},
+	{name: "lpInterval", modes: tlbModes, value: func(c *bondingConfig) *int { return c.LpInterval }, min: 1, max: math.MaxInt32},
+
+	{name: "minLinks", modes: lacpModes, value: func(c *bondingConfig) *int { return c.MinLinks }, min: 0, max: math.MaxInt32},
+	{name: "lacpRate", modes: lacpModes, isSet: func(c *bondingConfig) bool { return c.LacpRate != nil }},
+	{name: "lacpActive", modes: lacpModes, isSet: func(c *bondingConfig) bool { return c.LacpActive != nil }, attribute: unix.IFLA_BOND_AD_LACP_ACTIVE, minKernel: util.KernelVersion{Major: 5, Minor: 15}},
+	{name: "adSelect", modes: lacpModes, isSet: func(c *bondingConfig) bool { return c.AdSelect != nil }},
+	{name: "adActorSysPrio", modes: lacpModes, value: func(c *bondingConfig) *int { return c.AdActorSysPrio }, min: 1, max: 65535, attribute: unix.IFLA_BOND_AD_ACTOR_SYS_PRIO, minKernel: util.KernelVersion{Major: 4, Minor: 2}},
+	{name: "adUserPortKey", modes: lacpModes, value: func(c *bondingConfig) *int { return c.AdUserPortKey }, min: 0, max: maxAdUserPortKey, attribute: unix.IFLA_BOND_AD_USER_PORT_KEY, minKernel: util.KernelVersion{Major: 4, Minor: 2}},
+	{name: "adActorSystem", modes: lacpModes, isSet: func(c *bondingConfig) bool { return c.AdActorSystem != nil }, attribute: unix.IFLA_BOND_AD_ACTOR_SYSTEM, minKernel: util.KernelVersion{Major: 4, Minor: 2}},
+}
+
+// xmit hash policies added after bonds could first be configured through netlink, with the upstream kernel adding them
+var xmitHashPolicyKernels = map[string]util.KernelVersion{
+	"encap2+3":    {Major: 3, Minor: 18},
+	"encap3+4":    {Major: 3, Minor: 18},
+	"vlan+srcmac": {Major: 5, Minor: 12},
+}
+
+// options counted in MII monitor intervals, which the kernel only accepts while the MII monitor is enabled
+var miimonDelays = []string{"updelay", "downdelay", "peerNotifDelay"}
+
+// bondOptionDefaults sets an option to the value the kernel gives it when it is not configured. failOverMac is always
+// set, primary is cleared separately and the kernel refuses the all-zero adActorSystem it starts with, so it is kept
+var bondOptionDefaults = map[string]func(c *bondingConfig){
+	"allSlavesActive": func(c *bondingConfig) { c.AllSlavesActive = ptr(0) },
+	"tlbDynamicLb":    func(c *bondingConfig) { c.TlbDynamicLb = ptr(1) },
+	"xmitHashPolicy":  func(c *bondingConfig) { c.XmitHashPolicy = ptr("layer2") },
+
+	"arpInterval":   func(c *bondingConfig) { c.ArpInterval = ptr(0) },
+	"arpIpTargets":  func(c *bondingConfig) { c.ArpIpTargets = []string{} },
+	"arpValidate":   func(c *bondingConfig) { c.ArpValidate = ptr("none") },
+	"arpAllTargets": func(c *bondingConfig) { c.ArpAllTargets = ptr("any") },
+	"arpMissedMax":  func(c *bondingConfig) { c.ArpMissedMax = ptr(2) },
+	"nsIp6Targets":  func(c *bondingConfig) { c.NsIp6Targets = []string{} },
+
+	"updelay":        func(c *bondingConfig) { c.UpDelay = ptr(0) },
+	"downdelay":      func(c *bondingConfig) { c.DownDelay = ptr(0) },
+	"peerNotifDelay": func(c *bondingConfig) { c.PeerNotifDelay = ptr(0) },
+
+	"primaryReselect": func(c *bondingConfig) { c.PrimaryReselect = ptr("always") },
+
+	// both set the same kernel option, which is only reset when neither is configured
+	"numGratArp": func(c *bondingConfig) {
+		if c.NumUnsolNa == nil {
+			c.NumGratArp = ptr(1)
+		}
+	},
+	"numUnsolNa": func(c *bondingConfig) {
+		if c.NumGratArp == nil {
+			c.NumUnsolNa = ptr(1)
+		}
+	},
+	"resendIgmp": func(c *bondingConfig) { c.ResendIgmp = ptr(1) },
+
+	"packetsPerSlave": func(c *bondingConfig) { c.PacketsPerSlave = ptr(1) },
+	"lpInterval":      func(c *bondingConfig) { c.LpInterval = ptr(1) },
+
+	"minLinks":       func(c *bondingConfig) { c.MinLinks = ptr(0) },
+	"lacpRate":       func(c *bondingConfig) { c.LacpRate = ptr("slow") },
+	"lacpActive":     func(c *bondingConfig) { c.LacpActive = ptr("on") },
+	"adSelect":       func(c *bondingConfig) { c.AdSelect = ptr("stable") },
+	"adActorSysPrio": func(c *bondingConfig) { c.AdActorSysPrio = ptr(65535) },
+	"adUserPortKey":  func(c *bondingConfig) { c.AdUserPortKey = ptr(0) },
+}
+
+// configured reports whether the option is set in the bondConf
+func (rule *bondOptionRule) configured(bondConf *bondingConfig) bool {
+	return rule.value != nil && rule.value(bondConf) != nil || rule.isSet != nil && rule.isSet(bondConf)
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func nonZero(value int) *int {
+	if value == 0 {
+		return nil
+	}
+	return &value
+}
+
+// configError is a problem found in one field of the configuration
+type configError struct {
+	field string
+	err   error
+}
+
+// configErrors collects the problems found in the configuration, so they are all reported at once
+type configErrors []configError
+
+// add records err against the field, unless err is nil
+func (e *configErrors) add(field string, err error) {
+	if err != nil {
+		*e = append(*e, configError{field: field, err: err})
+	}
+}
+
+// asError returns nil for a valid configuration, or a single CNI error listing the problems by field
+func (e configErrors) asError() error {
+	if len(e) == 0 {
+		return nil
+	}
+	details := []string{}
+	for _, configErr := range e {
+		details = append(details, fmt.Sprintf("%+v: %+v", configErr.field, configErr.err))
+	}
+	return types.NewError(types.ErrInvalidNetworkConfig, fmt.Sprintf("invalid bond configuration, %+v error(s)", len(e)), strings.Join(details, "; "))
+}
+
+// check every configured option applies to the bond mode and is within its range. add the problems to errs
+func validateBondOptions(bondConf *bondingConfig, bondMode netlink.BondMode, errs *configErrors) {
+	for _, rule := range bondOptionRules {
+		if !rule.configured(bondConf) {
+			continue
+		}
+		var value *int
+		if rule.value != nil {
+			value = rule.value(bondConf)
+		}
+
+		if value != nil && (*value < rule.min || *value > rule.max) {
+			errs.add(rule.name, fmt.Errorf("%+v should be between %+v and %+v, actual: %+v", rule.name, rule.min, rule.max, *value))
+		}
+
+		// an unknown mode is reported on its own
+		if rule.modes != nil && bondMode != netlink.BOND_MODE_UNKNOWN && !slices.Contains(rule.modes, bondMode) {
+			modeNames := []string{}
+			for _, mode := range rule.modes {
+				modeNames = append(modeNames, mode.String())
+			}
+			errs.add(rule.name, fmt.Errorf("%+v is not supported in %+v mode, supported modes: %+v", rule.name, bondConf.Mode, strings.Join(modeNames, ", ")))
+		}
+	}
+}
+
+// check the running kernel reported back every configured option with an IFLA_BOND attribute, as kernels
+// ignore the attributes they do not know. add the options missing from the bond attributes to errs
+func validateKernelSupport(bondConf *bondingConfig, attributes map[uint16][]byte, kernel string, errs *configErrors) {
+	for _, rule := range bondOptionRules {
+		if rule.attribute == 0 || !rule.configured(bondConf) {
+			continue
+		}
+		if _, ok := attributes[rule.attribute]; !ok {
+			errs.add(rule.name, fmt.Errorf("%+v is not supported by the running kernel (%+v), it requires kernel %+v or later", rule.name, kernel, rule.minKernel))
+		}
+	}
+}
+
+// check the running kernel knows the xmitHashPolicy of the bondConf, which the bond cannot be created with
+// otherwise. the kernel refuses it with an EINVAL that does not name the option. add the problem to errs
+func validateXmitHashPolicySupport(bondConf *bondingConfig, kernel util.KernelVersion, errs *configErrors) {
+	if bondConf.XmitHashPolicy == nil {
+		return
+	}
+	if minKernel, ok := xmitHashPolicyKernels[*bondConf.XmitHashPolicy]; ok && !kernel.AtLeast(minKernel) {
+		errs.add("xmitHashPolicy", fmt.Errorf("xmitHashPolicy %+v is not supported by the running kernel (%+v), it requires kernel %+v or later",
+			*bondConf.XmitHashPolicy, kernel, minKernel))
+	}
+}
+
+// set the options prevConf configured and the bondConf no longer does to their kernel default, so a bond left by a
+// previous ADD does not keep them. options which do not apply to the mode of the bondConf are left as they are, as
+// are the delays when the bondConf disables the MII monitor, since the kernel refuses them then.
+// return whether an option was reset
+func resetRemovedOptions(bondConf *bondingConfig, prevConf *bondingConfig) bool {
+	bondMode := netlink.StringToBondMode(bondConf.Mode)
+	miimon, err := getMiimon(bondConf)
+	miimonDisabled := err == nil && miimon == 0
+	optionsReset := false
+	for _, rule := range bondOptionRules {
+		setDefault, ok := bondOptionDefaults[rule.name]
+		if !ok || !rule.configured(prevConf) || rule.configured(bondConf) {
+			continue
+		}
+		if rule.modes != nil && !slices.Contains(rule.modes, bondMode) {
+			continue
+		}
+		if miimonDisabled && slices.Contains(miimonDelays, rule.name) {
+			continue
+		}
+		setDefault(bondConf)
+		optionsReset = true
+	}
+	return optionsReset
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// SetBondOptions sets bond options which have no field in netlink.Bond, on the bond in the network namespace at nspath
+func SetBondOptions(nspath string, bondIndex int, options []*nl.RtAttr) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_ACK)
+
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(bondIndex)
+	req.AddData(msg)
+
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated("bond"))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	for _, option := range options {
+		data.AddChild(option)
+	}
+	req.AddData(linkInfo)
+
+	// the request is sent from a socket opened in the network namespace of the bond
+	return ns.WithNetNSPath(nspath, func(ns.NetNS) error {
+		if _, err := req.Execute(unix.NETLINK_ROUTE, 0); err != nil {
+			return fmt.Errorf("failed to set options of bond (index %+v), error: %+v", bondIndex, err)
+		}
+		return nil
+	})
+}
+
+// GetBondOptions returns the IFLA_BOND attributes the kernel reports for the bond at bondIndex, in the network
+// namespace at nspath, by attribute type. attributes the running kernel does not know are never reported
+func GetBondOptions(nspath string, bondIndex int) (map[uint16][]byte, error) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(bondIndex)
+	req.AddData(msg)
+
+	var msgs [][]byte
+	err := ns.WithNetNSPath(nspath, func(ns.NetNS) error {
+		var err error
+		if msgs, err = req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK); err != nil {
+			return fmt.Errorf("failed to get options of bond (index %+v), error: %+v", bondIndex, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("failed to get options of bond (index %+v), error: no link returned", bondIndex)
+	}
+
+	linkInfo, err := findAttribute(msgs[0][unix.SizeofIfInfomsg:], unix.IFLA_LINKINFO)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse link info of bond (index %+v), error: %+v", bondIndex, err)
+	}
+	data, err := findAttribute(linkInfo, nl.IFLA_INFO_DATA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse link data of bond (index %+v), error: %+v", bondIndex, err)
+	}
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse options of bond (index %+v), error: %+v", bondIndex, err)
+	}
+
+	options := map[uint16][]byte{}
+	for _, attr := range attrs {
+		options[attr.Attr.Type&^unix.NLA_F_NESTED] = attr.Value
+	}
+	return options, nil
+}
+
+// return the value of the first attribute of type attrType in b & error
+func findAttribute(b []byte, attrType uint16) ([]byte, error) {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type&^unix.NLA_F_NESTED == attrType {
+			return attr.Value, nil
+		}
+	}
+	return nil, fmt.Errorf("attribute %+v not found", attrType)
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// KernelVersion is the major and minor version of a kernel release
+type KernelVersion struct {
+	Major int
+	Minor int
+}
+
+// AtLeast reports whether the version is the same as or later than other
+func (v KernelVersion) AtLeast(other KernelVersion) bool {
+	return v.Major > other.Major || v.Major == other.Major && v.Minor >= other.Minor
+}
+
+func (v KernelVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// KernelCapabilities describes what the running kernel supports for bonds
+type KernelCapabilities struct {
+	Version                KernelVersion
+	BondingModuleAvailable bool
+}
+
+var (
+	probeOnce          sync.Once
+	kernelCapabilities *KernelCapabilities
+	errProbe           error
+)
+
+// ProbeKernelCapabilities probes the running kernel, only once per invocation of the plugin
+func ProbeKernelCapabilities() (*KernelCapabilities, error) {
+	probeOnce.Do(func() {
+		version, err := GetKernelVersion()
+		if err != nil {
+			errProbe = err
+			return
+		}
+		available, err := IsBondingModuleAvailable()
+		if err != nil {
+			errProbe = err
+			return
+		}
+		kernelCapabilities = &KernelCapabilities{
+			Version:                version,
+			BondingModuleAvailable: available,
+		}
+	})
+	return kernelCapabilities, errProbe
+}
+
+// GetKernelVersion returns the version of the running kernel
+func GetKernelVersion() (KernelVersion, error) {
+	uname := unix.Utsname{}
+	if err := unix.Uname(&uname); err != nil {
+		return KernelVersion{}, fmt.Errorf("failed to get kernel release, error: %+v", err)
+	}
+	return ParseKernelRelease(unix.ByteSliceToString(uname.Release[:]))
+}
+
+// ParseKernelRelease returns the version of a kernel release such as "5.14.0-427.13.1.el9_4.x86_64"
+func ParseKernelRelease(release string) (KernelVersion, error) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return KernelVersion{}, fmt.Errorf("failed to parse kernel release (%+v)", release)
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return KernelVersion{}, fmt.Errorf("failed to parse kernel release (%+v), error: %+v", release, err)
+	}
+
+	// the minor version may be directly followed by a suffix, such as "6.1-rc2"
+	minorDigits := fields[1]
+	if end := strings.IndexFunc(minorDigits, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		minorDigits = minorDigits[:end]
+	}
+	minor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return KernelVersion{}, fmt.Errorf("failed to parse kernel release (%+v), error: %+v", release, err)
+	}
+	return KernelVersion{Major: major, Minor: minor}, nil
+}
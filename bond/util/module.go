@@ -0,0 +1,104 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	bondingModule  = "bonding"
+	sysModuleDir   = "/sys/module"
+	libModulesDir  = "/lib/modules"
+	osReleaseFile  = "/proc/sys/kernel/osrelease"
+	procModules    = "/proc/modules"
+	bondingKoMatch = "/" + bondingModule + ".ko"
+)
+
+// IsBondingModuleLoaded reports whether the bonding driver is loaded or built into the running kernel
+func IsBondingModuleLoaded() bool {
+	if _, err := os.Stat(filepath.Join(sysModuleDir, bondingModule)); err == nil {
+		return true
+	}
+
+	// sysfs may not be mounted where the plugin runs, /proc/modules still lists loadable modules
+	modules, err := os.ReadFile(procModules)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(modules), "\n") {
+		// entries look like "bonding 237568 0 - Live 0x0000000000000000"
+		if name, _, _ := strings.Cut(line, " "); name == bondingModule {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadBondingModule loads the bonding driver with modprobe, unless it is already loaded
+func LoadBondingModule() error {
+	if IsBondingModuleLoaded() {
+		return nil
+	}
+
+	output, err := exec.Command("modprobe", bondingModule).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to load the bonding kernel module, error: %+v, output: %+v", err, strings.TrimSpace(string(output)))
+	}
+	if !IsBondingModuleLoaded() {
+		return fmt.Errorf("bonding kernel module is not loaded after modprobe")
+	}
+	return nil
+}
+
+// IsBondingModuleAvailable reports whether the bonding driver is loaded, or can be loaded on demand
+// when the first bond is created, because it is shipped with the running kernel
+func IsBondingModuleAvailable() (bool, error) {
+	if IsBondingModuleLoaded() {
+		return true, nil
+	}
+
+	release, err := os.ReadFile(osReleaseFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read kernel release, error: %+v", err)
+	}
+	modulesDir := filepath.Join(libModulesDir, strings.TrimSpace(string(release)))
+
+	for _, index := range []string{"modules.builtin", "modules.dep"} {
+		found, err := indexListsBonding(filepath.Join(modulesDir, index))
+		if err != nil {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func indexListsBonding(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open modules index (%+v), error: %+v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// entries look like "kernel/drivers/net/bonding/bonding.ko.xz: kernel/net/tls/tls.ko.xz"
+		modulePath, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.Contains(modulePath, bondingKoMatch) {
+			return true, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read modules index (%+v), error: %+v", path, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,12 @@
+package util
+
+import (
+	"regexp"
+)
+
+var pciAddressRegexp = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$`)
+
+// IsPCIAddress reports whether pciAddress is a full PCI address such as 0000:03:02.0
+func IsPCIAddress(pciAddress string) bool {
+	return pciAddressRegexp.MatchString(pciAddress)
+}
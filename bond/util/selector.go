@@ -0,0 +1,112 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/netlinksafe"
+	"github.com/safchain/ethtool"
+	"github.com/vishvananda/netlink"
+)
+
+// LinkSelector describes a link by its attributes rather than its name, every field set must match
+type LinkSelector struct {
+	NameGlob   string
+	MAC        net.HardwareAddr
+	AltName    string
+	Alias      string
+	Driver     string
+	PCIAddress string
+}
+
+// FindLink returns the only link of the current network namespace matched by the selector
+func FindLink(selector *LinkSelector) (netlink.Link, error) {
+	links, err := netlinksafe.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links, error: %+v", err)
+	}
+
+	// driver and bus info are only reported through ethtool
+	var ethHandle *ethtool.Ethtool
+	if selector.Driver != "" || selector.PCIAddress != "" {
+		if ethHandle, err = ethtool.NewEthtool(); err != nil {
+			return nil, fmt.Errorf("failed to create ethtool handle, error: %+v", err)
+		}
+		defer ethHandle.Close()
+	}
+
+	matches := []netlink.Link{}
+	matchNames := []string{}
+	for _, link := range links {
+		// a bond shares the MAC address of its slaves and is never a slave itself
+		if link.Type() == "bond" {
+			continue
+		}
+		if selector.matches(link, ethHandle) {
+			matches = append(matches, link)
+			matchNames = append(matchNames, link.Attrs().Name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("failed to find a link matching selector (%+v)", selector)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("links (%+v) all match selector (%+v), expected exactly one", matchNames, selector)
+	}
+}
+
+func (s *LinkSelector) matches(link netlink.Link, ethHandle *ethtool.Ethtool) bool {
+	attrs := link.Attrs()
+	if s.NameGlob != "" {
+		if matched, _ := filepath.Match(s.NameGlob, attrs.Name); !matched {
+			return false
+		}
+	}
+	// an enslaved link may carry the MAC address of the bond, its permanent address is kept
+	if s.MAC != nil && !slices.Equal(s.MAC, attrs.HardwareAddr) && !slices.Equal(s.MAC, attrs.PermHWAddr) {
+		return false
+	}
+	if s.AltName != "" && !slices.Contains(attrs.AltNames, s.AltName) {
+		return false
+	}
+	if s.Alias != "" && s.Alias != attrs.Alias {
+		return false
+	}
+	if s.Driver != "" {
+		driver, err := ethHandle.DriverName(attrs.Name)
+		if err != nil || driver != s.Driver {
+			return false
+		}
+	}
+	if s.PCIAddress != "" {
+		busInfo, err := ethHandle.BusInfo(attrs.Name)
+		if err != nil || !strings.EqualFold(busInfo, s.PCIAddress) {
+			return false
+		}
+	}
+	return true
+}
+
+// String prints only the fields set in the selector
+func (s *LinkSelector) String() string {
+	fields := []string{}
+	for _, field := range []struct{ key, value string }{
+		{"nameGlob", s.NameGlob},
+		{"mac", s.MAC.String()},
+		{"altName", s.AltName},
+		{"alias", s.Alias},
+		{"driver", s.Driver},
+		{"pciAddress", s.PCIAddress},
+	} {
+		if field.value != "" {
+			fields = append(fields, field.key+"="+field.value)
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDataDir is the directory where the state of each bond attachment is persisted
+const DefaultDataDir = "/var/lib/cni/bond"
+
+// SlaveState is a snapshot of a link taken before it was enslaved to the bond
+type SlaveState struct {
+	Name        string `json:"name"`
+	Mac         string `json:"mac"`
+	MTU         int    `json:"mtu"`
+	AdminUp     bool   `json:"adminUp"`
+	InContainer bool   `json:"inContainer"`
+}
+
+// AttachmentState is the record persisted on ADD for a container ID and interface name pair.
+// Links holds the name each link entry of Config was resolved to, in the order of the entries
+type AttachmentState struct {
+	ContainerID string          `json:"containerId"`
+	IfName      string          `json:"ifName"`
+	Netns       string          `json:"netns"`
+	Links       []string        `json:"links,omitempty"`
+	Slaves      []SlaveState    `json:"slaves"`
+	Config      json.RawMessage `json:"config"`
+	Result      json.RawMessage `json:"result,omitempty"`
+}
+
+// the state of an attachment is kept in a directory per container ID, neither the container ID
+// nor the interface name may contain a path separator so no two attachments share a path
+func attachmentStatePath(dataDir, containerID, ifName string) string {
+	return filepath.Join(dataDir, containerID, ifName+".json")
+}
+
+// SaveAttachmentState writes the state atomically so a crash never leaves a truncated record behind
+func SaveAttachmentState(dataDir string, state *AttachmentState) error {
+	path := attachmentStatePath(dataDir, state.ContainerID, state.IfName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory (%+v), error: %+v", filepath.Dir(path), err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal attachment state, error: %+v", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write attachment state (%+v), error: %+v", tmpPath, err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write attachment state (%+v), error: %+v", path, err)
+	}
+	return nil
+}
+
+// LoadAttachmentState returns the state recorded for the attachment, or nil if there is none
+func LoadAttachmentState(dataDir, containerID, ifName string) (*AttachmentState, error) {
+	path := attachmentStatePath(dataDir, containerID, ifName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read attachment state (%+v), error: %+v", path, err)
+	}
+
+	state := &AttachmentState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse attachment state (%+v), error: %+v", path, err)
+	}
+	return state, nil
+}
+
+// DeleteAttachmentState removes the state recorded for the attachment, a missing record is not an error
+func DeleteAttachmentState(dataDir, containerID, ifName string) error {
+	path := attachmentStatePath(dataDir, containerID, ifName)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete attachment state (%+v), error: %+v", path, err)
+	}
+	// the directory of the container is kept while other interfaces of the container have a state
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// ListAttachmentStates returns every attachment state recorded in dataDir. states which cannot be read are
+// skipped and reported in the returned error, alongside the states which could
+func ListAttachmentStates(dataDir string) ([]*AttachmentState, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read state directory (%+v), error: %+v", dataDir, err)
+	}
+
+	states := []*AttachmentState{}
+	var problems []error
+	for _, containerEntry := range entries {
+		if !containerEntry.IsDir() {
+			continue
+		}
+
+		containerDir := filepath.Join(dataDir, containerEntry.Name())
+		stateEntries, err := os.ReadDir(containerDir)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("failed to read state directory (%+v), error: %+v", containerDir, err))
+			continue
+		}
+		for _, entry := range stateEntries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+
+			path := filepath.Join(containerDir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("failed to read attachment state (%+v), error: %+v", path, err))
+				continue
+			}
+
+			state := &AttachmentState{}
+			if err = json.Unmarshal(data, state); err != nil {
+				problems = append(problems, fmt.Errorf("failed to parse attachment state (%+v), error: %+v", path, err))
+				continue
+			}
+			states = append(states, state)
+		}
+	}
+	return states, errors.Join(problems...)
+}